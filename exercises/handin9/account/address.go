@@ -0,0 +1,96 @@
+package account
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// addressVersion is prepended to the key hash so that future formats can be told apart
+const addressVersion byte = 0x00
+
+// payloadSize is the number of bytes of the public key hash kept in the address
+const payloadSize = 20
+
+// checksumSize is the number of bytes of the checksum appended to the address
+const checksumSize = 4
+
+// AddressFromKey returns the canonical address (base58 of version, key hash and checksum) of a public key
+func AddressFromKey(pubKey string) string {
+	hash := sha256.Sum256([]byte(pubKey))
+
+	payload := append([]byte{addressVersion}, hash[:payloadSize]...)
+
+	return base58Encode(append(payload, checksum(payload)...))
+}
+
+// ValidAddress checks that a string is a well formed address with a correct checksum
+func ValidAddress(address string) bool {
+	raw, ok := base58Decode(address)
+	if !ok || len(raw) != 1+payloadSize+checksumSize || raw[0] != addressVersion {
+		return false
+	}
+
+	payload := raw[:1+payloadSize]
+
+	return bytes.Equal(raw[1+payloadSize:], checksum(payload))
+}
+
+// checksum returns the first bytes of the double sha256 of the payload
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+
+	return second[:checksumSize]
+}
+
+// base58Encode encodes bytes in base58 keeping leading zeros as '1'
+func base58Encode(b []byte) string {
+	var mod big.Int
+	x := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+
+	out := []byte{}
+	for x.Sign() > 0 {
+		x.DivMod(x, radix, &mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	// reverse as digits were added from the least significant
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
+
+// base58Decode decodes a base58 string, returns false if it contains invalid characters
+func base58Decode(s string) ([]byte, bool) {
+	x := big.NewInt(0)
+	radix := big.NewInt(58)
+
+	for _, c := range []byte(s) {
+		i := bytes.IndexByte([]byte(base58Alphabet), c)
+		if i < 0 {
+			return nil, false
+		}
+		x.Mul(x, radix)
+		x.Add(x, big.NewInt(int64(i)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+
+	return append(make([]byte, zeros), x.Bytes()...), true
+}
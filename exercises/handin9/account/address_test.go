@@ -0,0 +1,51 @@
+package account
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddressFromKey(t *testing.T) {
+	addr := AddressFromKey("-----BEGIN KEY-----\nsome key\n-----END KEY-----\n")
+
+	if !ValidAddress(addr) {
+		t.Errorf("Address %s is not valid", addr)
+	}
+
+	if addr != AddressFromKey("-----BEGIN KEY-----\nsome key\n-----END KEY-----\n") {
+		t.Errorf("Address is not deterministic")
+	}
+
+	if addr == AddressFromKey("Genesis") {
+		t.Errorf("Different keys have the same address")
+	}
+}
+
+func TestValidAddressChecksum(t *testing.T) {
+	addr := AddressFromKey("Genesis")
+
+	// change one character to another in the alphabet
+	c := "2"
+	if addr[5:6] == c {
+		c = "3"
+	}
+	typo := addr[:5] + c + addr[6:]
+
+	if ValidAddress(typo) {
+		t.Errorf("Address with a typo %s is considered valid", typo)
+	}
+
+	if ValidAddress(strings.Replace(addr, addr[1:2], "0", 1)) {
+		t.Errorf("Address with invalid character is considered valid")
+	}
+}
+
+func TestBase58RoundTrip(t *testing.T) {
+	for _, in := range [][]byte{{0, 0, 1, 2}, {255, 0}, {0}} {
+		out, ok := base58Decode(base58Encode(in))
+
+		if !ok || string(out) != string(in) {
+			t.Errorf("Base58 round trip failed: %v != %v", out, in)
+		}
+	}
+}
@@ -59,6 +59,14 @@ func (l *TransactionMap) Reset() {
 	l.data = make(map[string]Transaction, 1)
 }
 
+// Len returns the number of transactions in the map
+func (l *TransactionMap) Len() int {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return len(l.data)
+}
+
 // Iter is method that allows to iterate on the map
 func (l *TransactionMap) Iter() <-chan Transaction { // not synchronyzed enough for union
 	c := make(chan Transaction)
@@ -7,9 +7,10 @@ import (
 	"sync"
 )
 
-// Ledger is synchronized account map
+// Ledger is synchronized account map, indexed by address (see AddressFromKey)
 type Ledger struct {
 	Accounts map[string]uint64
+	multisig map[string]MultisigAccount
 	lock     sync.RWMutex
 }
 
@@ -17,9 +18,38 @@ type Ledger struct {
 func NewLedger() *Ledger {
 	var l Ledger
 	l.Accounts = make(map[string]uint64, 1)
+	l.multisig = map[string]MultisigAccount{}
 	return &l
 }
 
+// Reset empties every account but keeps the registered multisig accounts
+func (l *Ledger) Reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Accounts = make(map[string]uint64, 1)
+}
+
+// RegisterMultisig registers a m-of-n account and returns its address
+func (l *Ledger) RegisterMultisig(m MultisigAccount) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	address := m.Address()
+	l.multisig[address] = m
+
+	return address
+}
+
+// GetMultisig returns the multisig account registered with the address
+func (l *Ledger) GetMultisig(address string) (MultisigAccount, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	m, found := l.multisig[address]
+	return m, found
+}
+
 // Transaction is method of ledger that applies a transaction to itself
 func (l *Ledger) Transaction(t Transaction) {
 	l.lock.Lock()
@@ -79,6 +109,18 @@ func (l *Ledger) AddToBalance(peer string, amount uint64) {
 	l.Accounts[peer] += amount
 }
 
+// Burn destroys all the money of a peer and returns the amount
+func (l *Ledger) Burn(peer string) uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	amount, found := l.Accounts[peer]
+	if found {
+		l.Accounts[peer] = 0
+	}
+	return amount
+}
+
 // Copy returns a copy of the ledger, transactioon on the copy won't affect the original
 func (l *Ledger) Copy() *Ledger {
 	l.lock.RLock()
@@ -90,6 +132,10 @@ func (l *Ledger) Copy() *Ledger {
 		c.Accounts[k] = v
 	}
 
+	for k, v := range l.multisig {
+		c.multisig[k] = v
+	}
+
 	return c
 }
 
@@ -100,7 +146,10 @@ func (l *Ledger) String() string {
 	s := "\t\tLEDGER:\n"
 	for _, key := range l.GetSortedKeys() {
 		value := l.Accounts[key]
-		s = s + fmt.Sprintf("Account: "+key[30:39]+" | Value: "+strconv.Itoa(int(value))+"\n")
+		if m, found := l.multisig[key]; found {
+			key += " (" + m.String() + ")"
+		}
+		s = s + fmt.Sprintf("Account: "+key+" | Value: "+strconv.Itoa(int(value))+"\n")
 	}
 
 	return s
@@ -0,0 +1,96 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"../aesrsa"
+)
+
+// MultisigAccount is an account controlled by at least Threshold of the Keys (public keys, sorted)
+type MultisigAccount struct {
+	Threshold int
+	Keys      []string
+}
+
+// NewMultisigAccount is the constructor of m-of-n accounts
+func NewMultisigAccount(threshold int, keys []string) (MultisigAccount, error) {
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+
+	m := MultisigAccount{
+		Threshold: threshold,
+		Keys:      sorted}
+
+	if err := m.validate(); err != nil {
+		return MultisigAccount{}, err
+	}
+
+	for _, k := range sorted {
+		if _, err := aesrsa.VerifierFromString(k); err != nil {
+			return MultisigAccount{}, err
+		}
+	}
+
+	return m, nil
+}
+
+// Address returns the address of the account, derived from threshold and keys
+func (m MultisigAccount) Address() string {
+	jsonM, err := json.Marshal(m)
+	check(err)
+
+	return AddressFromKey(string(jsonM))
+}
+
+// validate checks 1 <= threshold <= n and that keys are sorted and distinct
+func (m MultisigAccount) validate() error {
+	if m.Threshold < 1 || m.Threshold > len(m.Keys) {
+		return errors.New("Threshold must be between 1 and the number of keys")
+	}
+
+	for i := 1; i < len(m.Keys); i++ {
+		if m.Keys[i-1] >= m.Keys[i] {
+			return errors.New("Keys must be sorted and distinct")
+		}
+	}
+
+	return nil
+}
+
+// verify checks that at least Threshold of the signatures are valid on msg
+func (m MultisigAccount) verify(msg []byte, signatures []string) bool {
+	if m.validate() != nil || len(signatures) != len(m.Keys) {
+		return false
+	}
+
+	valid := 0
+
+	for i, key := range m.Keys {
+		if signatures[i] == "" {
+			continue
+		}
+
+		sign, err := decodeSignature(signatures[i])
+		if err != nil {
+			return false
+		}
+
+		verifier, err := aesrsa.VerifierFromString(key)
+		if err != nil {
+			return false
+		}
+
+		if verifier.Verify(msg, sign) {
+			valid++
+		}
+	}
+
+	return valid >= m.Threshold
+}
+
+func (m MultisigAccount) String() string {
+	return fmt.Sprintf("%d-of-%d", m.Threshold, len(m.Keys))
+}
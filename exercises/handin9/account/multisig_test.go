@@ -0,0 +1,76 @@
+package account
+
+import (
+	"testing"
+
+	"../aesrsa"
+)
+
+func TestMultisigTransaction(t *testing.T) {
+	signers := []aesrsa.Signer{}
+	keys := []string{}
+
+	for i := 0; i < 3; i++ {
+		s, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+		keys = append(keys, aesrsa.VerifierToString(s.Verifier()))
+	}
+
+	m, err := NewMultisigAccount(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tran := NewTransaction("0", m.Address(), AddressFromKey(keys[0]), 10)
+	st := NewMultisigTransaction(tran, m)
+
+	if err := st.Cosign(signers[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.VerifyTransaction() {
+		t.Errorf("Transaction with 1 of 2 signatures is verified")
+	}
+
+	if err := st.Cosign(signers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if !st.VerifyTransaction() {
+		t.Errorf("Transaction with 2 of 2 signatures isn't verified")
+	}
+
+	st.Amount = 100
+	if st.VerifyTransaction() {
+		t.Errorf("Modified transaction is verified")
+	}
+}
+
+func TestMultisigAccountInvalid(t *testing.T) {
+	s, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := aesrsa.VerifierToString(s.Verifier())
+
+	if _, err := NewMultisigAccount(2, []string{key}); err == nil {
+		t.Errorf("Threshold higher than the number of keys is accepted")
+	}
+
+	if _, err := NewMultisigAccount(1, []string{key, key}); err == nil {
+		t.Errorf("Duplicated keys are accepted")
+	}
+
+	tran := NewTransaction("0", AddressFromKey(key), "someone", 10)
+	st := NewMultisigTransaction(tran, MultisigAccount{Threshold: 1, Keys: []string{key}})
+	if err := st.Cosign(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.VerifyTransaction() {
+		t.Errorf("Multisig transaction from a single key address is verified")
+	}
+}
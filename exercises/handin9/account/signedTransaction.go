@@ -2,19 +2,23 @@ package account
 
 import (
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 
 	"../aesrsa"
 )
 
 // SignedTransaction is an atomic operation on a ledger
+// Single key accounts fill PubKey and Signature, multisig accounts fill Multisig and Signatures
 type SignedTransaction struct {
-	ID        string
-	From      string
-	To        string
-	Amount    uint64
-	Signature string
+	ID         string
+	From       string
+	To         string
+	Amount     uint64
+	PubKey     string
+	Signature  string
+	Multisig   *MultisigAccount
+	Signatures []string // one per Multisig.Keys, empty if the key didn't sign
 }
 
 // ExtractTransaction extracts the transaction from the signed one
@@ -26,38 +30,99 @@ func (st SignedTransaction) ExtractTransaction() Transaction {
 		Amount: st.Amount}
 }
 
-// SignTransaction signs a transaction as the sender
-func SignTransaction(t Transaction, privKey aesrsa.RSAKey) SignedTransaction {
-	jsonT, err := json.Marshal(t)
-	check(err)
-
-	sign := base64.StdEncoding.EncodeToString(aesrsa.SignRSA(jsonT, privKey))
+// SignTransaction signs a transaction as the sender, attaching the public key matching t.From
+func SignTransaction(t Transaction, signer aesrsa.Signer) SignedTransaction {
+	sign := base64.StdEncoding.EncodeToString(signer.Sign(t.bytes()))
 
 	return SignedTransaction{
 		ID:        t.ID,
 		From:      t.From,
 		To:        t.To,
 		Amount:    t.Amount,
+		PubKey:    aesrsa.VerifierToString(signer.Verifier()),
 		Signature: sign}
 }
 
-// VerifyTransaction verifies that a transaction signature corresponds to the sender
-func (st SignedTransaction) VerifyTransaction() bool {
-	t := st.ExtractTransaction()
-	jsonT, err := json.Marshal(t)
-	check(err)
+// NewMultisigTransaction prepares a transaction from a multisig account to be cosigned
+func NewMultisigTransaction(t Transaction, m MultisigAccount) SignedTransaction {
+	return SignedTransaction{
+		ID:         t.ID,
+		From:       t.From,
+		To:         t.To,
+		Amount:     t.Amount,
+		Multisig:   &m,
+		Signatures: make([]string, len(m.Keys))}
+}
+
+// Cosign adds the signature of one of the keys of the multisig account
+func (st *SignedTransaction) Cosign(signer aesrsa.Signer) error {
+	if st.Multisig == nil {
+		return errors.New("Not a multisig transaction")
+	}
 
-	sign, err := base64.StdEncoding.DecodeString(st.Signature)
-	check(err)
+	key := aesrsa.VerifierToString(signer.Verifier())
 
-	return aesrsa.VerifyRSA(jsonT, sign, aesrsa.KeyFromString(st.From))
+	for i, k := range st.Multisig.Keys {
+		if k == key {
+			sign := signer.Sign(st.ExtractTransaction().bytes())
+			st.Signatures[i] = base64.StdEncoding.EncodeToString(sign)
+			return nil
+		}
+	}
+
+	return errors.New("Key is not part of the multisig account")
 }
 
-// WhatType returns "Block" for SignedTransaction type
-func (st SignedTransaction) WhatType() string {
-	return "SignedTransaction"
+// CountSignatures returns the number of signatures attached
+func (st SignedTransaction) CountSignatures() int {
+	if st.Multisig == nil {
+		if st.Signature == "" {
+			return 0
+		}
+		return 1
+	}
+
+	n := 0
+	for _, s := range st.Signatures {
+		if s != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// VerifyTransaction verifies that the public key(s) belong to the sender address and the signature(s) correspond to it
+func (st SignedTransaction) VerifyTransaction() bool {
+	msg := st.ExtractTransaction().bytes()
+
+	if st.Multisig != nil {
+		return st.Multisig.Address() == st.From && st.Multisig.verify(msg, st.Signatures)
+	}
+
+	if AddressFromKey(st.PubKey) != st.From {
+		return false
+	}
+
+	sign, err := decodeSignature(st.Signature)
+	if err != nil {
+		return false
+	}
+
+	verifier, err := aesrsa.VerifierFromString(st.PubKey)
+	if err != nil {
+		return false
+	}
+
+	return verifier.Verify(msg, sign)
 }
 
 func (st SignedTransaction) String() string {
+	if st.Multisig != nil {
+		return fmt.Sprintf("SignedTransaction:\n%s,\nMultisig %s,\nSignatures %v", st.ExtractTransaction().String(), st.Multisig, st.Signatures)
+	}
 	return fmt.Sprintf("SignedTransaction:\n%s,\nSignature %s", st.ExtractTransaction().String(), st.Signature)
 }
+
+func decodeSignature(sign string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(sign)
+}
@@ -1,10 +1,11 @@
 package account
 
 import (
+	"encoding/json"
 	"fmt"
 )
 
-// Transaction is an atomic operation on a ledger
+// Transaction is an atomic operation on a ledger, From and To are addresses
 type Transaction struct {
 	ID     string
 	From   string
@@ -21,6 +22,14 @@ func NewTransaction(ID, From, To string, Amount uint64) Transaction {
 		Amount: Amount}
 }
 
+// bytes returns the encoding of the transaction that gets signed
+func (t Transaction) bytes() []byte {
+	jsonT, err := json.Marshal(t)
+	check(err)
+
+	return jsonT
+}
+
 func (t Transaction) String() string {
 	return fmt.Sprintf("Transaction: ID %s,\nFrom\n%s,\nTo\n%s,\nAmount %d", t.ID, t.From, t.To, t.Amount)
 }
@@ -1,6 +0,0 @@
-package account
-
-// WhatType discerns what type a struct is
-type WhatType interface {
-	WhatType() string
-}
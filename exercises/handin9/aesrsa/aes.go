@@ -45,20 +45,34 @@ func encryptAES(pt, key []byte) []byte {
 
 // decryptAES returns the ciphertext  of the plain text given the key in bytes
 func decryptAES(ct, key []byte) []byte {
+	pt, err := tryDecryptAES(ct, key)
+	check(err)
+
+	return pt
+}
+
+// tryDecryptAES is decryptAES returning an error (e.g. wrong key) instead of panicking
+func tryDecryptAES(ct, key []byte) ([]byte, error) {
 	// // padding key
 	// pwBytes, err := pkcs7Pad(key, 32)
 	// check(err)
 
 	// creating block
 	block, err := aes.NewCipher(key)
-	check(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ct) < aes.BlockSize {
+		return nil, errors.New("Ciphertext is shorter than the IV")
+	}
 
 	// dividing IV and proper ct
 	iv := ct[:aes.BlockSize]
 	ct = ct[aes.BlockSize:]
 
 	if (len(ct) % aes.BlockSize) != 0 {
-		panic(errors.New("Ciphertext should have been multiple of aes.Blocksize"))
+		return nil, errors.New("Ciphertext should have been multiple of aes.Blocksize")
 	}
 
 	// allocating for plaintext without IV
@@ -68,10 +82,7 @@ func decryptAES(ct, key []byte) []byte {
 	streamCipher.XORKeyStream(pt, ct)
 
 	// unpad plaintext
-	pt, err = pkcs7Unpad(pt, aes.BlockSize)
-	check(err)
-
-	return pt
+	return pkcs7Unpad(pt, aes.BlockSize)
 }
 
 // EncryptToFile to a given file an input string given an AES-key
@@ -0,0 +1,253 @@
+package aesrsa
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The secure channel is a station-to-station handshake:
+// 1. both ends send an ephemeral X25519 public key
+// 2. the shared secret and the transcript give an AES-GCM key per direction
+// 3. both ends send, encrypted, their long term public key and a signature of the transcript
+// so each end proves it owns its key and the channel can't be read or modified by others.
+
+// LinkAuthContext prefixes the messages signed to authenticate a channel
+var LinkAuthContext = []byte("handin9 link authentication")
+
+// maxFrameSize is the biggest plaintext sent in a single frame
+const maxFrameSize = 1 << 16
+
+// SecureConn wraps conn in an encrypted channel authenticated with the signer on both ends,
+// it returns the new connection and the proven public key of the remote end
+func SecureConn(conn net.Conn, signer Signer, initiator bool) (net.Conn, string, error) {
+	curve := ecdh.X25519()
+
+	eph, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// exchange ephemeral keys
+	if err := writeFrame(conn, eph.PublicKey().Bytes()); err != nil {
+		return nil, "", err
+	}
+	remoteBytes, err := readFrame(conn)
+	if err != nil {
+		return nil, "", err
+	}
+	remoteEph, err := curve.NewPublicKey(remoteBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	shared, err := eph.ECDH(remoteEph)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// transcript is the ephemeral keys ordered as initiator, responder
+	transcript := append(eph.PublicKey().Bytes(), remoteBytes...)
+	if !initiator {
+		transcript = append(append([]byte{}, remoteBytes...), eph.PublicKey().Bytes()...)
+	}
+
+	sc, err := newSecureConn(conn, shared, transcript, initiator)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// authenticate both ends
+	localKey := VerifierToString(signer.Verifier())
+	sig := signer.Sign(authMessage(transcript, initiator))
+	if err := writeFrame(sc, append(encodeField([]byte(localKey)), encodeField(sig)...)); err != nil {
+		return nil, "", err
+	}
+
+	auth, err := readFrame(sc)
+	if err != nil {
+		return nil, "", err
+	}
+	remoteKey, rest, err := decodeField(auth)
+	if err != nil {
+		return nil, "", err
+	}
+	remoteSig, _, err := decodeField(rest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	verifier, err := VerifierFromString(string(remoteKey))
+	if err != nil {
+		return nil, "", err
+	}
+	if !verifier.Verify(authMessage(transcript, !initiator), remoteSig) {
+		return nil, "", errors.New("remote end could not prove its key")
+	}
+
+	return sc, string(remoteKey), nil
+}
+
+// authMessage is what each end signs, the role avoids reflecting a signature back
+func authMessage(transcript []byte, initiator bool) []byte {
+	role := byte(0)
+	if initiator {
+		role = 1
+	}
+	hash := sha256.Sum256(transcript)
+
+	msg := append([]byte{}, LinkAuthContext...)
+	msg = append(msg, role)
+	return append(msg, hash[:]...)
+}
+
+// secureConn is a net.Conn encrypting every frame with AES-GCM
+type secureConn struct {
+	net.Conn
+
+	send, recv           cipher.AEAD
+	sendNonce, recvNonce uint64
+	readBuf              []byte
+
+	readLock, writeLock sync.Mutex
+}
+
+func newSecureConn(conn net.Conn, shared, transcript []byte, initiator bool) (*secureConn, error) {
+	kdf := hkdf.New(sha256.New, shared, transcript, LinkAuthContext)
+
+	keyI2R := make([]byte, 32)
+	keyR2I := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, keyI2R); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(kdf, keyR2I); err != nil {
+		return nil, err
+	}
+
+	i2r, err := newGCM(keyI2R)
+	if err != nil {
+		return nil, err
+	}
+	r2i, err := newGCM(keyR2I)
+	if err != nil {
+		return nil, err
+	}
+
+	if initiator {
+		return &secureConn{Conn: conn, send: i2r, recv: r2i}, nil
+	}
+	return &secureConn{Conn: conn, send: r2i, recv: i2r}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Read decrypts the next frames as needed, fails if a frame was modified or replayed
+func (sc *secureConn) Read(p []byte) (int, error) {
+	sc.readLock.Lock()
+	defer sc.readLock.Unlock()
+
+	for len(sc.readBuf) == 0 {
+		ct, err := readFrame(sc.Conn)
+		if err != nil {
+			return 0, err
+		}
+
+		pt, err := sc.recv.Open(nil, nonce(sc.recvNonce, sc.recv.NonceSize()), ct, nil)
+		if err != nil {
+			return 0, errors.New("secure channel: message authentication failed")
+		}
+		sc.recvNonce++
+		sc.readBuf = pt
+	}
+
+	n := copy(p, sc.readBuf)
+	sc.readBuf = sc.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts p in one or more frames
+func (sc *secureConn) Write(p []byte) (int, error) {
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+
+	written := 0
+	for written < len(p) {
+		end := written + maxFrameSize
+		if end > len(p) {
+			end = len(p)
+		}
+
+		ct := sc.send.Seal(nil, nonce(sc.sendNonce, sc.send.NonceSize()), p[written:end], nil)
+		sc.sendNonce++
+
+		if err := writeFrame(sc.Conn, ct); err != nil {
+			return written, err
+		}
+		written = end
+	}
+
+	return written, nil
+}
+
+// nonce is the counter of frames big endian
+func nonce(counter uint64, size int) []byte {
+	n := make([]byte, size)
+	binary.BigEndian.PutUint64(n[size-8:], counter)
+	return n
+}
+
+/////////// framing utils ///////////
+
+func writeFrame(w io.Writer, data []byte) error {
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	_, err := w.Write(append(buf, data...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > 2*maxFrameSize {
+		return nil, errors.New("secure channel: frame too big")
+	}
+
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+func encodeField(data []byte) []byte {
+	var buf bytes.Buffer
+	writeFrame(&buf, data)
+	return buf.Bytes()
+}
+
+func decodeField(data []byte) ([]byte, []byte, error) {
+	r := bytes.NewReader(data)
+	field, err := readFrame(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return field, data[4+len(field):], nil
+}
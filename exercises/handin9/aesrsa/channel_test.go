@@ -0,0 +1,59 @@
+package aesrsa
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSecureConn(t *testing.T) {
+	server, err := GenerateSigner(Ed25519)
+	checkTest(err, t)
+	client, err := GenerateSigner(RSA)
+	checkTest(err, t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	checkTest(err, t)
+	defer ln.Close()
+
+	msg := bytes.Repeat([]byte("msg"), maxFrameSize)
+	done := make(chan string)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- ""
+			return
+		}
+		sc, remoteKey, err := SecureConn(conn, server, false)
+		if err != nil {
+			done <- ""
+			return
+		}
+		sc.Write(msg)
+		done <- remoteKey
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	checkTest(err, t)
+
+	sc, remoteKey, err := SecureConn(conn, client, true)
+	checkTest(err, t)
+
+	if remoteKey != VerifierToString(server.Verifier()) {
+		t.Errorf("Client did not get the server key")
+	}
+
+	if <-done != VerifierToString(client.Verifier()) {
+		t.Errorf("Server did not get the client key")
+	}
+
+	out := make([]byte, len(msg))
+	_, err = io.ReadFull(sc, out)
+	checkTest(err, t)
+
+	if !bytes.Equal(out, msg) {
+		t.Errorf("Message received differs from the one sent")
+	}
+}
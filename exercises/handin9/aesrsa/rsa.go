@@ -85,6 +85,13 @@ func findPrimeNotCoprime(bits int, e *big.Int) (*big.Int, error) {
 	return p, nil
 }
 
+// PublicKey returns the public key corresponding to a private key (the public exponent is fixed)
+func PublicKey(privKey RSAKey) RSAKey {
+	return RSAKey{
+		N:   new(big.Int).Set(privKey.N),
+		Exp: new(big.Int).Set(publicExponent)}
+}
+
 // Encrypt plaintext big.Int using RSAKey
 func Encrypt(pt *big.Int, pubKey RSAKey) *big.Int {
 	var ct big.Int
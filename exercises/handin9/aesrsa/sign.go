@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"io/ioutil"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -32,10 +33,15 @@ var saltSize = 64
 
 // Generate wallet (file with private key encrypted) and return public key
 func Generate(filename string, password string) string {
-	ptKeys, err := KeyGen(2048)
+	return GenerateWallet(filename, password, RSA)
+}
+
+// GenerateWallet creates a wallet with a key of the given algorithm and returns the public key
+func GenerateWallet(filename string, password string, alg Algorithm) string {
+	signer, err := GenerateSigner(alg)
 	check(err)
 
-	pt := []byte(KeyToString(ptKeys.Private))
+	pt := []byte(SignerToString(signer))
 
 	salt := make([]byte, saltSize)
 	_, err = rand.Read(salt)
@@ -45,23 +51,45 @@ func Generate(filename string, password string) string {
 
 	ct := encryptAES(pt, keyAes)
 
-	err = ioutil.WriteFile(filename, append(salt, ct...), 0644)
+	err = ioutil.WriteFile(filename, append(salt, ct...), 0600)
 	check(err)
 
-	return KeyToString(ptKeys.Public)
+	return VerifierToString(signer.Verifier())
 }
 
-// Sign signs a message given a wallet with a private key and relative password
-func Sign(filename string, password string, msg []byte) []byte {
+// OpenWallet decrypts the key in a wallet, returns an error if the password is wrong
+func OpenWallet(filename string, password string) (Signer, error) {
 	ct, err := ioutil.ReadFile(filename)
-	check(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ct) < saltSize {
+		return nil, errors.New("Wallet file is too short")
+	}
 
 	salt := ct[:saltSize]
 	ct = ct[saltSize:]
 
 	keyAes := pbkdf2.Key([]byte(password), salt, 4096, 32, sha256.New)
 
-	privKey := KeyFromString(string(decryptAES(ct, keyAes)))
+	pt, err := tryDecryptAES(ct, keyAes)
+	if err != nil {
+		return nil, errors.New("Wrong password or corrupted wallet")
+	}
+
+	signer, err := SignerFromString(string(pt))
+	if err != nil {
+		return nil, errors.New("Wrong password or corrupted wallet")
+	}
+
+	return signer, nil
+}
+
+// Sign signs a message given a wallet with a private key and relative password
+func Sign(filename string, password string, msg []byte) []byte {
+	signer, err := OpenWallet(filename, password)
+	check(err)
 
-	return SignRSA(msg, privKey)
+	return signer.Sign(msg)
 }
@@ -0,0 +1,343 @@
+package aesrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// Algorithm identifies the signature scheme of a key
+type Algorithm string
+
+// Supported signature algorithms
+const (
+	RSA       Algorithm = "RSA"
+	Ed25519   Algorithm = "Ed25519"
+	ECDSAP256 Algorithm = "ECDSA-P256"
+)
+
+// algorithmHeader is the PEM header tagging the algorithm of a key (missing means RSA)
+const algorithmHeader = "Algorithm"
+
+// Signer signs messages with a secret key
+type Signer interface {
+	Algorithm() Algorithm
+	Sign(msg []byte) []byte
+	// Prove returns the VRF proof of alpha (see vrf.go)
+	Prove(alpha []byte) ([]byte, error)
+	Verifier() Verifier
+}
+
+// Verifier checks signatures with a public key
+type Verifier interface {
+	Algorithm() Algorithm
+	Verify(msg, sig []byte) bool
+	// VerifyProof checks a VRF proof of alpha and returns the VRF output
+	VerifyProof(alpha, proof []byte) ([]byte, bool)
+}
+
+// ParseAlgorithm returns the algorithm given its name (case insensitive)
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for _, alg := range []Algorithm{RSA, Ed25519, ECDSAP256} {
+		if strings.EqualFold(name, string(alg)) {
+			return alg, nil
+		}
+	}
+	if strings.EqualFold(name, "ecdsa") {
+		return ECDSAP256, nil
+	}
+	return "", errors.New("Unknown algorithm " + name)
+}
+
+// GenerateSigner creates a new secret key for the given algorithm
+func GenerateSigner(alg Algorithm) (Signer, error) {
+	switch alg {
+	case RSA:
+		keys, err := KeyGen(2048)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSASigner(keys.Private), nil
+	case Ed25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519Signer{priv}, nil
+	case ECDSAP256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaSigner{priv}, nil
+	}
+	return nil, errors.New("Unknown algorithm " + string(alg))
+}
+
+// NewRSASigner wraps a private RSAKey as a Signer
+func NewRSASigner(privKey RSAKey) Signer {
+	return rsaSigner{privKey}
+}
+
+// SignerToString encodes the secret key of a signer to a PEM string
+func SignerToString(s Signer) string {
+	switch s := s.(type) {
+	case rsaSigner:
+		return KeyToString(s.priv)
+	case ed25519Signer:
+		return encodeKey(Ed25519, s.priv)
+	case ecdsaSigner:
+		bits, err := x509.MarshalECPrivateKey(s.priv)
+		check(err)
+		return encodeKey(ECDSAP256, bits)
+	}
+	panic(errors.New("Signer cannot be encoded"))
+}
+
+// SignerFromString decodes a secret key encoded by SignerToString
+func SignerFromString(str string) (Signer, error) {
+	alg, bits, err := decodeKey(str)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case RSA:
+		key, err := rsaKeyFromBytes(bits)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSASigner(key), nil
+	case Ed25519:
+		if len(bits) != ed25519.PrivateKeySize {
+			return nil, errors.New("Incorrect Ed25519 secret key size")
+		}
+		return ed25519Signer{ed25519.PrivateKey(bits)}, nil
+	case ECDSAP256:
+		priv, err := x509.ParseECPrivateKey(bits)
+		if err != nil {
+			return nil, err
+		}
+		if priv.Curve != elliptic.P256() {
+			return nil, errors.New("Incorrect ECDSA curve")
+		}
+		return ecdsaSigner{priv}, nil
+	}
+	return nil, errors.New("Unknown algorithm " + string(alg))
+}
+
+// VerifierToString encodes a public key to a PEM string
+func VerifierToString(v Verifier) string {
+	switch v := v.(type) {
+	case rsaVerifier:
+		return KeyToString(v.pub)
+	case ed25519Verifier:
+		return encodeKey(Ed25519, v.pub)
+	case ecdsaVerifier:
+		bits, err := x509.MarshalPKIXPublicKey(v.pub)
+		check(err)
+		return encodeKey(ECDSAP256, bits)
+	}
+	panic(errors.New("Verifier cannot be encoded"))
+}
+
+// VerifierFromString decodes a public key encoded by VerifierToString
+func VerifierFromString(str string) (Verifier, error) {
+	alg, bits, err := decodeKey(str)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case RSA:
+		key, err := rsaKeyFromBytes(bits)
+		if err != nil {
+			return nil, err
+		}
+		return rsaVerifier{key}, nil
+	case Ed25519:
+		if len(bits) != ed25519.PublicKeySize {
+			return nil, errors.New("Incorrect Ed25519 public key size")
+		}
+		return ed25519Verifier{ed25519.PublicKey(bits)}, nil
+	case ECDSAP256:
+		pub, err := x509.ParsePKIXPublicKey(bits)
+		if err != nil {
+			return nil, err
+		}
+		ecPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok || ecPub.Curve != elliptic.P256() {
+			return nil, errors.New("Incorrect ECDSA public key")
+		}
+		return ecdsaVerifier{ecPub}, nil
+	}
+	return nil, errors.New("Unknown algorithm " + string(alg))
+}
+
+// StoreSigner writes the secret key of a signer to a file (encrypted)
+func StoreSigner(s Signer, file, pw string) {
+	EncryptToFile([]byte(SignerToString(s)), file, pw)
+}
+
+// ReadSigner retrieves a signer from a file (decrypting it), files written by StoreKeyPair are accepted too
+func ReadSigner(file, pw string) Signer {
+	out := DecryptFromFile(file, pw)
+
+	keys := &RSAKeyPair{}
+	if err := json.Unmarshal(out, keys); err == nil {
+		return NewRSASigner(keys.Private)
+	}
+
+	s, err := SignerFromString(string(out))
+	check(err)
+
+	return s
+}
+
+// StoreVerifier writes a public key to a file (encrypted)
+func StoreVerifier(v Verifier, file, pw string) {
+	EncryptToFile([]byte(VerifierToString(v)), file, pw)
+}
+
+// ReadVerifier retrieves a public key from a file (decrypting it), files written by StoreKey are accepted too
+func ReadVerifier(file, pw string) Verifier {
+	out := DecryptFromFile(file, pw)
+
+	key := &RSAKey{}
+	if err := json.Unmarshal(out, key); err == nil {
+		return rsaVerifier{*key}
+	}
+
+	v, err := VerifierFromString(string(out))
+	check(err)
+
+	return v
+}
+
+/////////// PEM utils ///////////
+
+func encodeKey(alg Algorithm, bits []byte) string {
+	block := &pem.Block{
+		Type:    "KEY",
+		Headers: map[string]string{algorithmHeader: string(alg)},
+		Bytes:   bits,
+	}
+
+	return string(pem.EncodeToMemory(block))
+}
+
+func decodeKey(str string) (Algorithm, []byte, error) {
+	block, _ := pem.Decode([]byte(str))
+	if block == nil || block.Type != "KEY" {
+		return "", nil, errors.New("Incorrect key format")
+	}
+
+	alg, found := block.Headers[algorithmHeader]
+	if !found {
+		return RSA, block.Bytes, nil
+	}
+
+	return Algorithm(alg), block.Bytes, nil
+}
+
+func rsaKeyFromBytes(bits []byte) (RSAKey, error) {
+	key := RSAKey{}
+	_, err := asn1.Unmarshal(bits, &key)
+	if err == nil && (key.N == nil || key.Exp == nil || key.N.Sign() <= 0) {
+		err = errors.New("Incorrect RSA key")
+	}
+	return key, err
+}
+
+/////////// RSA ///////////
+
+type rsaSigner struct {
+	priv RSAKey
+}
+
+func (s rsaSigner) Algorithm() Algorithm { return RSA }
+
+func (s rsaSigner) Sign(msg []byte) []byte {
+	return SignRSA(msg, s.priv)
+}
+
+func (s rsaSigner) Verifier() Verifier {
+	return rsaVerifier{PublicKey(s.priv)}
+}
+
+type rsaVerifier struct {
+	pub RSAKey
+}
+
+func (v rsaVerifier) Algorithm() Algorithm { return RSA }
+
+func (v rsaVerifier) Verify(msg, sig []byte) bool {
+	return VerifyRSA(msg, sig, v.pub)
+}
+
+/////////// Ed25519 ///////////
+
+type ed25519Signer struct {
+	priv ed25519.PrivateKey
+}
+
+func (s ed25519Signer) Algorithm() Algorithm { return Ed25519 }
+
+func (s ed25519Signer) Sign(msg []byte) []byte {
+	return ed25519.Sign(s.priv, msg)
+}
+
+func (s ed25519Signer) Verifier() Verifier {
+	return ed25519Verifier{s.priv.Public().(ed25519.PublicKey)}
+}
+
+type ed25519Verifier struct {
+	pub ed25519.PublicKey
+}
+
+func (v ed25519Verifier) Algorithm() Algorithm { return Ed25519 }
+
+func (v ed25519Verifier) Verify(msg, sig []byte) bool {
+	return ed25519.Verify(v.pub, msg, sig)
+}
+
+/////////// ECDSA P-256 ///////////
+
+type ecdsaSigner struct {
+	priv *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Algorithm() Algorithm { return ECDSAP256 }
+
+func (s ecdsaSigner) Sign(msg []byte) []byte {
+	hash := sha256.Sum256(msg)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, s.priv, hash[:])
+	check(err)
+
+	return sig
+}
+
+func (s ecdsaSigner) Verifier() Verifier {
+	return ecdsaVerifier{&s.priv.PublicKey}
+}
+
+type ecdsaVerifier struct {
+	pub *ecdsa.PublicKey
+}
+
+func (v ecdsaVerifier) Algorithm() Algorithm { return ECDSAP256 }
+
+func (v ecdsaVerifier) Verify(msg, sig []byte) bool {
+	hash := sha256.Sum256(msg)
+
+	return ecdsa.VerifyASN1(v.pub, hash[:], sig)
+}
@@ -0,0 +1,60 @@
+package aesrsa
+
+import (
+	"testing"
+)
+
+func TestSignerAlgorithms(t *testing.T) {
+	msg := []byte("msg")
+
+	for _, alg := range []Algorithm{RSA, Ed25519, ECDSAP256} {
+		signer, err := GenerateSigner(alg)
+		checkTest(err, t)
+
+		sig := signer.Sign(msg)
+
+		if !signer.Verifier().Verify(msg, sig) {
+			t.Errorf("%s signature isn't verified", alg)
+		}
+
+		if signer.Verifier().Verify([]byte("other msg"), sig) {
+			t.Errorf("%s signature is verified on a modified message", alg)
+		}
+	}
+}
+
+func TestSignerToFromString(t *testing.T) {
+	msg := []byte("msg")
+
+	for _, alg := range []Algorithm{RSA, Ed25519, ECDSAP256} {
+		signer, err := GenerateSigner(alg)
+		checkTest(err, t)
+
+		decoded, err := SignerFromString(SignerToString(signer))
+		checkTest(err, t)
+
+		verifier, err := VerifierFromString(VerifierToString(signer.Verifier()))
+		checkTest(err, t)
+
+		if verifier.Algorithm() != alg || decoded.Algorithm() != alg {
+			t.Errorf("%s key decoded with wrong algorithm", alg)
+		}
+
+		if !verifier.Verify(msg, decoded.Sign(msg)) {
+			t.Errorf("%s signature with decoded keys isn't verified", alg)
+		}
+	}
+}
+
+func TestVerifierFromLegacyRSAKey(t *testing.T) {
+	keys, err := KeyGen(1024)
+	checkTest(err, t)
+
+	verifier, err := VerifierFromString(KeyToString(keys.Public))
+	checkTest(err, t)
+
+	msg := []byte("msg")
+	if verifier.Algorithm() != RSA || !verifier.Verify(msg, SignRSA(msg, keys.Private)) {
+		t.Errorf("Legacy RSA key isn't accepted as verifier")
+	}
+}
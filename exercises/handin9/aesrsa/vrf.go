@@ -0,0 +1,243 @@
+package aesrsa
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"filippo.io/edwards25519"
+)
+
+// The verifiable random functions below follow RFC 9381:
+// RSA-FDH-VRF-SHA256 for RSA keys and ECVRF-EDWARDS25519-SHA512-TAI for Ed25519 keys.
+// A proof can only be computed with the secret key, is unique for (key, alpha)
+// and anyone with the public key can check it and derive the same random output beta.
+
+// ErrVRFNotSupported is returned when the algorithm of a key has no VRF
+var ErrVRFNotSupported = errors.New("VRF not supported by the key algorithm")
+
+const (
+	rsaVRFSuite = 0x01
+	ecVRFSuite  = 0x03
+)
+
+/////////// Signer and Verifier methods ///////////
+
+// Prove returns the RSA-FDH-VRF proof of alpha
+func (s rsaSigner) Prove(alpha []byte) ([]byte, error) {
+	k := keyLength(s.priv)
+	m := new(big.Int).SetBytes(rsaVRFEncode(s.priv.N, k, alpha))
+
+	return i2osp(Decrypt(m, s.priv), k), nil
+}
+
+// VerifyProof checks a RSA-FDH-VRF proof of alpha and returns its output
+func (v rsaVerifier) VerifyProof(alpha, proof []byte) ([]byte, bool) {
+	// the keys are generated with publicExponent, another one (e.g. 1) would make the proofs easy to forge
+	if v.pub.Exp == nil || v.pub.Exp.Cmp(publicExponent) != 0 {
+		return nil, false
+	}
+
+	k := keyLength(v.pub)
+	if len(proof) != k {
+		return nil, false
+	}
+
+	s := new(big.Int).SetBytes(proof)
+	if s.Cmp(v.pub.N) >= 0 {
+		return nil, false
+	}
+
+	m := Encrypt(s, v.pub)
+	if m.BitLen() > (k-1)*8 {
+		return nil, false
+	}
+
+	if !bytes.Equal(i2osp(m, k-1), rsaVRFEncode(v.pub.N, k, alpha)) {
+		return nil, false
+	}
+
+	beta := sha256.Sum256(append([]byte{rsaVRFSuite, 0x02}, proof...))
+	return beta[:], true
+}
+
+// Prove returns the ECVRF proof of alpha
+func (s ed25519Signer) Prove(alpha []byte) ([]byte, error) {
+	hashedSK := sha512.Sum512(s.priv.Seed())
+	x, err := new(edwards25519.Scalar).SetBytesWithClamping(hashedSK[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	pk := s.priv.Public().(ed25519.PublicKey)
+	y, err := new(edwards25519.Point).SetBytes(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := ecVRFEncodeToCurve(pk, alpha)
+	if err != nil {
+		return nil, err
+	}
+
+	gamma := new(edwards25519.Point).ScalarMult(x, h)
+
+	// nonce as in RFC 8032
+	nonce := sha512.Sum512(append(append([]byte{}, hashedSK[32:]...), h.Bytes()...))
+	k, err := new(edwards25519.Scalar).SetUniformBytes(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	u := new(edwards25519.Point).ScalarBaseMult(k)
+	v := new(edwards25519.Point).ScalarMult(k, h)
+
+	c := ecVRFChallenge(y, h, gamma, u, v)
+	cScalar, err := challengeToScalar(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sScalar := new(edwards25519.Scalar).MultiplyAdd(cScalar, x, k)
+
+	proof := append(gamma.Bytes(), c...)
+	return append(proof, sScalar.Bytes()...), nil
+}
+
+// VerifyProof checks an ECVRF proof of alpha and returns its output
+func (v ed25519Verifier) VerifyProof(alpha, proof []byte) ([]byte, bool) {
+	if len(proof) != 80 {
+		return nil, false
+	}
+
+	y, err := new(edwards25519.Point).SetBytes(v.pub)
+	if err != nil {
+		return nil, false
+	}
+
+	gamma, err := new(edwards25519.Point).SetBytes(proof[:32])
+	if err != nil {
+		return nil, false
+	}
+
+	c := proof[32:48]
+	cScalar, err := challengeToScalar(c)
+	if err != nil {
+		return nil, false
+	}
+
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(proof[48:])
+	if err != nil {
+		return nil, false
+	}
+
+	h, err := ecVRFEncodeToCurve(v.pub, alpha)
+	if err != nil {
+		return nil, false
+	}
+
+	negC := new(edwards25519.Scalar).Negate(cScalar)
+
+	// U = s*B - c*Y, V = s*H - c*Gamma
+	u := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(negC, y, s)
+	w := new(edwards25519.Point).VarTimeMultiScalarMult([]*edwards25519.Scalar{s, negC}, []*edwards25519.Point{h, gamma})
+
+	if !bytes.Equal(c, ecVRFChallenge(y, h, gamma, u, w)) {
+		return nil, false
+	}
+
+	cofactorGamma := new(edwards25519.Point).MultByCofactor(gamma)
+	beta := sha512.Sum512(append(append([]byte{ecVRFSuite, 0x03}, cofactorGamma.Bytes()...), 0x00))
+	return beta[:], true
+}
+
+// Prove is not available for ECDSA keys
+func (s ecdsaSigner) Prove(alpha []byte) ([]byte, error) {
+	return nil, ErrVRFNotSupported
+}
+
+// VerifyProof is not available for ECDSA keys
+func (v ecdsaVerifier) VerifyProof(alpha, proof []byte) ([]byte, bool) {
+	return nil, false
+}
+
+/////////// RSA-FDH-VRF utils ///////////
+
+// keyLength returns the length in bytes of the modulus
+func keyLength(key RSAKey) int {
+	return (key.N.BitLen() + 7) / 8
+}
+
+// rsaVRFEncode hashes alpha to k-1 bytes with MGF1 salted with the modulus
+func rsaVRFEncode(n *big.Int, k int, alpha []byte) []byte {
+	salt := make([]byte, 4)
+	binary.BigEndian.PutUint32(salt, uint32(k))
+	salt = append(salt, i2osp(n, k)...)
+
+	seed := append([]byte{rsaVRFSuite, 0x01}, salt...)
+	seed = append(seed, alpha...)
+
+	return mgf1(seed, k-1)
+}
+
+// mgf1 is the mask generation function of PKCS #1 with sha256
+func mgf1(seed []byte, length int) []byte {
+	out := []byte{}
+	counter := make([]byte, 4)
+
+	for i := uint32(0); len(out) < length; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		hash := sha256.Sum256(append(append([]byte{}, seed...), counter...))
+		out = append(out, hash[:]...)
+	}
+
+	return out[:length]
+}
+
+// i2osp writes x big endian on exactly length bytes (x must fit)
+func i2osp(x *big.Int, length int) []byte {
+	out := make([]byte, length)
+	return x.FillBytes(out)
+}
+
+/////////// ECVRF utils ///////////
+
+// ecVRFEncodeToCurve hashes alpha to a point with the try and increment method
+func ecVRFEncodeToCurve(pk, alpha []byte) (*edwards25519.Point, error) {
+	for ctr := 0; ctr < 256; ctr++ {
+		str := append([]byte{ecVRFSuite, 0x01}, pk...)
+		str = append(str, alpha...)
+		str = append(str, byte(ctr), 0x00)
+
+		hash := sha512.Sum512(str)
+
+		if h, err := new(edwards25519.Point).SetBytes(hash[:32]); err == nil {
+			return h.MultByCofactor(h), nil
+		}
+	}
+
+	return nil, errors.New("Could not hash to curve")
+}
+
+// ecVRFChallenge returns the 16 bytes challenge given the points of the proof
+func ecVRFChallenge(points ...*edwards25519.Point) []byte {
+	str := []byte{ecVRFSuite, 0x02}
+	for _, p := range points {
+		str = append(str, p.Bytes()...)
+	}
+	str = append(str, 0x00)
+
+	hash := sha512.Sum512(str)
+	return hash[:16]
+}
+
+// challengeToScalar interprets the challenge as a little endian scalar
+func challengeToScalar(c []byte) (*edwards25519.Scalar, error) {
+	buf := make([]byte, 32)
+	copy(buf, c)
+	return new(edwards25519.Scalar).SetCanonicalBytes(buf)
+}
@@ -0,0 +1,88 @@
+package aesrsa
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestVRFProveVerify(t *testing.T) {
+	alpha := []byte("slot and seed")
+
+	for _, alg := range []Algorithm{RSA, Ed25519} {
+		signer, err := GenerateSigner(alg)
+		checkTest(err, t)
+
+		proof, err := signer.Prove(alpha)
+		checkTest(err, t)
+
+		beta, ok := signer.Verifier().VerifyProof(alpha, proof)
+		if !ok {
+			t.Errorf("%s VRF proof isn't verified", alg)
+		}
+
+		proof2, err := signer.Prove(alpha)
+		checkTest(err, t)
+		beta2, _ := signer.Verifier().VerifyProof(alpha, proof2)
+		if !bytes.Equal(beta, beta2) {
+			t.Errorf("%s VRF output is not unique", alg)
+		}
+
+		if _, ok := signer.Verifier().VerifyProof([]byte("other alpha"), proof); ok {
+			t.Errorf("%s VRF proof is verified for a different input", alg)
+		}
+
+		proof[len(proof)-1] ^= 1
+		if _, ok := signer.Verifier().VerifyProof(alpha, proof); ok {
+			t.Errorf("%s modified VRF proof is verified", alg)
+		}
+	}
+}
+
+func TestVRFRejectsOtherExponents(t *testing.T) {
+	alpha := []byte("slot and seed")
+	signer, err := GenerateSigner(RSA)
+	checkTest(err, t)
+
+	// with the exponent 1 the encoded input is its own proof
+	pub := signer.Verifier().(rsaVerifier).pub
+	forged := rsaVerifier{RSAKey{N: pub.N, Exp: big.NewInt(1)}}
+	k := keyLength(pub)
+	proof := i2osp(new(big.Int).SetBytes(rsaVRFEncode(pub.N, k, alpha)), k)
+
+	if _, ok := forged.VerifyProof(alpha, proof); ok {
+		t.Error("VRF proof verified with the exponent 1")
+	}
+}
+
+func TestECVRFVector(t *testing.T) {
+	// Example 16 of RFC 9381
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	expectedPi, _ := hex.DecodeString("8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f26f8a57ccaed74ee1b190bed1f479d9727d2d0f9b005a6e456a35d4fb0daab1268a1b0db10836d9826a528ca76567805")
+	expectedBeta, _ := hex.DecodeString("90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae")
+
+	signer := ed25519Signer{ed25519.NewKeyFromSeed(seed)}
+
+	pi, err := signer.Prove([]byte{})
+	checkTest(err, t)
+
+	if !bytes.Equal(pi, expectedPi) {
+		t.Errorf("ECVRF proof differs from the test vector: %x", pi)
+	}
+
+	beta, ok := signer.Verifier().VerifyProof([]byte{}, expectedPi)
+	if !ok || !bytes.Equal(beta, expectedBeta) {
+		t.Errorf("ECVRF output differs from the test vector: %x", beta)
+	}
+}
+
+func TestVRFNotSupported(t *testing.T) {
+	signer, err := GenerateSigner(ECDSAP256)
+	checkTest(err, t)
+
+	if _, err := signer.Prove([]byte("alpha")); err != ErrVRFNotSupported {
+		t.Errorf("ECDSA keys should not compute VRF proofs")
+	}
+}
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+	"../transport"
+)
+
+// Operations of the agent protocol
+const (
+	opList  = "list"
+	opSign  = "sign"
+	opProve = "prove"
+)
+
+// request is sent by the node to the agent over the unix socket
+type request struct {
+	Op   string
+	Key  string // public key to use
+	Data []byte // message to sign or VRF input
+}
+
+// response is sent by the agent to the node
+type response struct {
+	Keys []string
+	Data []byte
+	Err  string
+}
+
+// Agent holds decrypted keys and signs on request
+type Agent struct {
+	keys     map[string]aesrsa.Signer
+	order    []string // of the keys as added, the first one is the default of the clients
+	policies map[string]Policy
+	lock     sync.RWMutex
+}
+
+// NewAgent is the constructor of the Agent type
+func NewAgent() *Agent {
+	return &Agent{
+		keys:     map[string]aesrsa.Signer{},
+		policies: map[string]Policy{}}
+}
+
+// AddKey adds a key to the agent with the policy it must respect
+func (a *Agent) AddKey(signer aesrsa.Signer, policy Policy) string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key := aesrsa.VerifierToString(signer.Verifier())
+	if _, found := a.keys[key]; !found {
+		a.order = append(a.order, key)
+	}
+	a.keys[key] = signer
+	a.policies[key] = policy
+
+	return AddressFromKey(key)
+}
+
+// Serve accepts connections on the unix socket until quitCh is closed
+func (a *Agent) Serve(socket string, quitCh <-chan struct{}) error {
+	os.Remove(socket)
+
+	// only the owner can talk to the agent
+	ln, err := transport.ListenUnix(socket)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-quitCh
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-quitCh:
+				return nil //Done
+			default:
+				return err
+			}
+		}
+		go a.handleConn(conn)
+	}
+}
+
+func (a *Agent) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return //Done
+		}
+
+		res := a.handle(req)
+		if err := enc.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+func (a *Agent) handle(req request) response {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if req.Op == opList {
+		return response{Keys: append([]string{}, a.order...)}
+	}
+
+	signer, found := a.keys[req.Key]
+	if !found {
+		return response{Err: "Unknown key"}
+	}
+	policy := a.policies[req.Key]
+
+	switch req.Op {
+	case opSign:
+		if err := policy.allowSign(req.Key, req.Data); err != nil {
+			slog.Warn("Refused to sign", "account", AddressFromKey(req.Key), "err", err)
+			return response{Err: err.Error()}
+		}
+		return response{Data: signer.Sign(req.Data)}
+	case opProve:
+		if !policy.Nodes {
+			return response{Err: "Policy does not allow lottery draws"}
+		}
+		proof, err := signer.Prove(req.Data)
+		if err != nil {
+			return response{Err: err.Error()}
+		}
+		return response{Data: proof}
+	}
+
+	return response{Err: "Unknown operation " + req.Op}
+}
+
+// Policy restricts what the agent signs with a key
+type Policy struct {
+	Transactions bool     // sign transactions
+	Nodes        bool     // sign nodes and lottery draws
+	Links        bool     // authenticate connections to peers
+	MaxAmount    uint64   // maximum amount of a transaction, 0 for no limit
+	Multisig     []string // addresses of the multisig accounts whose transactions it cosigns
+}
+
+// DefaultPolicy allows signing everything
+var DefaultPolicy = Policy{
+	Transactions: true,
+	Nodes:        true,
+	Links:        true}
+
+// ReadPolicies reads a json file mapping addresses to policies
+func ReadPolicies(file string) (map[string]Policy, error) {
+	policies := map[string]Policy{}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &policies)
+	return policies, err
+}
+
+// allowSign checks the message to sign with key against the policy, recognizing transactions and nodes
+func (p Policy) allowSign(key string, msg []byte) error {
+	if bytes.HasPrefix(msg, aesrsa.LinkAuthContext) {
+		if !p.Links {
+			return errors.New("Policy does not allow links")
+		}
+		return nil
+	}
+
+	var t Transaction
+	if strictUnmarshal(msg, &t) == nil {
+		if !p.Transactions {
+			return errors.New("Policy does not allow transactions")
+		}
+		if t.From != AddressFromKey(key) && !p.cosigns(t.From) {
+			return errors.New("Transaction from another account " + t.From)
+		}
+		if p.MaxAmount > 0 && t.Amount > p.MaxAmount {
+			return fmt.Errorf("Amount %d above the limit %d", t.Amount, p.MaxAmount)
+		}
+		return nil
+	}
+
+	var n bt.Node
+	if strictUnmarshal(msg, &n) == nil {
+		if !p.Nodes {
+			return errors.New("Policy does not allow nodes")
+		}
+		return nil
+	}
+
+	return errors.New("Unknown message")
+}
+
+// cosigns returns true if the policy allows cosigning for the multisig account
+func (p Policy) cosigns(address string) bool {
+	for _, m := range p.Multisig {
+		if m == address {
+			return true
+		}
+	}
+	return false
+}
+
+// strictUnmarshal decodes a single json value without unknown fields nor anything after it
+func strictUnmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	var rest json.RawMessage
+	if dec.Decode(&rest) != io.EOF {
+		return errors.New("Data after the message")
+	}
+	return nil
+}
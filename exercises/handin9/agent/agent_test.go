@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+)
+
+func TestAgentSignsWithinPolicy(t *testing.T) {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAgent()
+	address := a.AddKey(signer, Policy{Transactions: true, MaxAmount: 10})
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	go a.Serve(socket, quitCh)
+
+	var client *Client
+	for i := 0; i < 50 && client == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		client, _ = Dial(socket)
+	}
+	if client == nil {
+		t.Fatal("Could not connect to the agent")
+	}
+	defer client.Close()
+
+	remote, err := client.Signer(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := SignTransaction(NewTransaction("0", address, "someone", 10), remote)
+	if !st.VerifyTransaction() || Refusal(remote) != nil {
+		t.Errorf("Transaction signed by the agent isn't verified")
+	}
+
+	st = SignTransaction(NewTransaction("1", address, "someone", 11), remote)
+	if st.VerifyTransaction() {
+		t.Errorf("Agent signed a transaction above the policy limit")
+	}
+	if Refusal(remote) == nil {
+		t.Errorf("Refusal of the agent not reported")
+	}
+
+	if _, err := remote.Prove([]byte("alpha")); err == nil {
+		t.Errorf("Agent computed a draw without the policy allowing nodes")
+	}
+}
+
+func TestAgentListsKeysInOrder(t *testing.T) {
+	a := NewAgent()
+	keys := []string{}
+	for i := 0; i < 5; i++ {
+		signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.AddKey(signer, Policy{})
+		keys = append(keys, aesrsa.VerifierToString(signer.Verifier()))
+	}
+
+	listed := a.handle(request{Op: opList}).Keys
+	if len(listed) != len(keys) {
+		t.Fatal("Wrong number of keys", len(listed))
+	}
+	for i := range keys {
+		if listed[i] != keys[i] {
+			t.Fatal("Keys not listed in the order they were added")
+		}
+	}
+}
+
+func TestPolicyChecksTheWholeTransaction(t *testing.T) {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := aesrsa.VerifierToString(signer.Verifier())
+	m, err := NewMultisigAccount(1, []string{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{Transactions: true, MaxAmount: 10, Multisig: []string{m.Address()}}
+
+	own, _ := json.Marshal(NewTransaction("0", AddressFromKey(key), "someone", 10))
+	if err := p.allowSign(key, own); err != nil {
+		t.Error("Own transaction refused", err)
+	}
+
+	// a second transaction hidden after the checked one
+	big, _ := json.Marshal(NewTransaction("1", AddressFromKey(key), "someone", 1000))
+	if err := p.allowSign(key, append(own, big...)); err == nil {
+		t.Error("Signed a message with data after the transaction")
+	}
+	if err := p.allowSign(key, append(own, ']')); err == nil {
+		t.Error("Signed a message with garbage after the transaction")
+	}
+
+	other, _ := json.Marshal(NewTransaction("2", "another account", "someone", 10))
+	if err := p.allowSign(key, other); err == nil {
+		t.Error("Signed a transaction of another account")
+	}
+
+	cosigned, _ := json.Marshal(NewTransaction("3", m.Address(), "someone", 10))
+	if err := p.allowSign(key, cosigned); err != nil {
+		t.Error("Transaction of a multisig account of the policy refused", err)
+	}
+}
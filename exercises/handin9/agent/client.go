@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"encoding/gob"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+
+	. "../account"
+	"../aesrsa"
+)
+
+// Client is a connection to a signing agent
+type Client struct {
+	conn net.Conn
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+	lock sync.Mutex
+}
+
+// Dial connects to the agent listening on the unix socket
+func Dial(socket string) (*Client, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn: conn,
+		enc:  gob.NewEncoder(conn),
+		dec:  gob.NewDecoder(conn)}, nil
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// Keys returns the public keys held by the agent in the order they were added
+func (c *Client) Keys() ([]string, error) {
+	res, err := c.call(request{Op: opList})
+	return res.Keys, err
+}
+
+// Signer returns a Signer for the key with the given address held by the agent,
+// an empty address selects the first key added to the agent (the one of its first wallet)
+func (c *Client) Signer(address string) (aesrsa.Signer, error) {
+	keys, err := c.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if address == "" || AddressFromKey(k) == address {
+			verifier, err := aesrsa.VerifierFromString(k)
+			if err != nil {
+				return nil, err
+			}
+			return &remoteSigner{client: c, key: k, verifier: verifier}, nil
+		}
+	}
+
+	return nil, errors.New("Agent does not hold the key of " + address)
+}
+
+func (c *Client) call(req request) (response, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var res response
+
+	if err := c.enc.Encode(req); err != nil {
+		return res, err
+	}
+	if err := c.dec.Decode(&res); err != nil {
+		return res, err
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+
+	return res, nil
+}
+
+// remoteSigner implements aesrsa.Signer forwarding requests to the agent
+type remoteSigner struct {
+	client   *Client
+	key      string
+	verifier aesrsa.Verifier
+
+	refusal     error // of the last Sign, see Refusal
+	refusalLock sync.Mutex
+}
+
+func (s *remoteSigner) Algorithm() aesrsa.Algorithm {
+	return s.verifier.Algorithm()
+}
+
+// Sign returns nil (an invalid signature) if the agent refuses, see Refusal
+func (s *remoteSigner) Sign(msg []byte) []byte {
+	res, err := s.client.call(request{Op: opSign, Key: s.key, Data: msg})
+
+	s.refusalLock.Lock()
+	s.refusal = err
+	s.refusalLock.Unlock()
+
+	if err != nil {
+		slog.Warn("The agent did not sign", "err", err)
+		return nil
+	}
+	return res.Data
+}
+
+// Refusal returns why the agent did not sign the last message passed to Sign of a signer
+// returned by Client.Signer, nil if it signed or the signer is not of an agent
+func Refusal(signer aesrsa.Signer) error {
+	s, ok := signer.(*remoteSigner)
+	if !ok {
+		return nil
+	}
+
+	s.refusalLock.Lock()
+	defer s.refusalLock.Unlock()
+	return s.refusal
+}
+
+func (s *remoteSigner) Prove(alpha []byte) ([]byte, error) {
+	res, err := s.client.call(request{Op: opProve, Key: s.key, Data: alpha})
+	return res.Data, err
+}
+
+func (s *remoteSigner) Verifier() aesrsa.Verifier {
+	return s.verifier
+}
@@ -0,0 +1,81 @@
+package blocktree
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of the time of the tree, so that the slots can be simulated in tests
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once the duration elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the clock of the system
+type RealClock struct{}
+
+// Now returns the current local time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SimClock is a simulated clock, the time moves only when Advance is called
+type SimClock struct {
+	now    time.Time
+	timers []simTimer
+	lock   sync.Mutex
+}
+
+type simTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewSimClock creates a simulated clock starting at the given time
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+// Now returns the simulated time
+func (c *SimClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// After returns a channel receiving the simulated time once advanced by the duration
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.timers = append(c.timers, simTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the time forward firing the timers due, in order
+func (c *SimClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+	for len(c.timers) > 0 && !c.timers[0].at.After(c.now) {
+		c.timers[0].ch <- c.timers[0].at
+		c.timers = c.timers[1:]
+	}
+}
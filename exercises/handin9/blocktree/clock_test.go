@@ -0,0 +1,54 @@
+package blocktree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimClockFiresInOrder(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewSimClock(start)
+
+	late := c.After(2 * time.Second)
+	early := c.After(time.Second)
+
+	c.Advance(1500 * time.Millisecond)
+	select {
+	case at := <-early:
+		if !at.Equal(start.Add(time.Second)) {
+			t.Error("Timer fired at", at)
+		}
+	default:
+		t.Fatal("Due timer not fired")
+	}
+	select {
+	case <-late:
+		t.Fatal("Timer fired early")
+	default:
+	}
+
+	c.Advance(time.Second)
+	if _, ok := <-late; !ok || !c.Now().Equal(start.Add(2500*time.Millisecond)) {
+		t.Error("Wrong time after advancing")
+	}
+}
+
+func TestSlotsFollowTheClock(t *testing.T) {
+	tree := NewTree(nil)
+	c := NewSimClock(time.Unix(1000, 0))
+	tree.Clock = c
+
+	slot := tree.GetCurrentSlot()
+	next := tree.AfterSlot(slot+1, 0)
+
+	c.Advance(tree.SlotLength)
+	<-next
+	if tree.GetCurrentSlot() != slot+1 {
+		t.Error("Slot not advanced with the clock")
+	}
+
+	tree.SetTimeOffset(-tree.SlotLength)
+	if tree.GetCurrentSlot() != slot {
+		t.Error("Offset not applied")
+	}
+}
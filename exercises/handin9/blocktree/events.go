@@ -0,0 +1,125 @@
+package blocktree
+
+import (
+	"fmt"
+
+	. "../account"
+)
+
+// EventType is the kind of change of the chain of the head
+type EventType string
+
+// Types of events, in the order they are notified for an update of the head
+const (
+	ReorgEvent       EventType = "reorg"       // nodes left the chain, the head moved to another branch
+	TransactionEvent EventType = "transaction" // a transaction was applied to the ledger
+	BalanceEvent     EventType = "balance"     // the balance of an account changed
+	HeadEvent        EventType = "head"        // the chain has a new head
+)
+
+// Event describes a change of the chain of the head, only the fields of its type are set
+type Event struct {
+	Type        EventType
+	Slot        uint64       `json:",omitempty"` // of the node (the new head, the one of the transaction or the common ancestor of a reorg)
+	Node        string       `json:",omitempty"` // hash of the node
+	Reverted    []string     `json:",omitempty"` // hashes of the nodes which left the chain, the newest first
+	Transaction *Transaction `json:",omitempty"`
+	Account     string       `json:",omitempty"`
+	Balance     uint64       `json:",omitempty"`
+}
+
+// Subscribe calls f with the events of every update of the head. It is called while
+// the tree is locked, so it must not block nor call the tree
+func (t *Tree) Subscribe(f func(events []Event)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.subscribers = append(t.subscribers, f)
+}
+
+// notify sends to the subscribers the events of the move of the head from oldHead,
+// before is the ledger of oldHead
+func (t *Tree) notify(oldHead nodeHash, before *Ledger) {
+	if eqH(oldHead, t.head) {
+		return
+	}
+
+	reverted, applied, ancestor := t.branches(oldHead, t.head)
+	events := []Event{}
+
+	if len(reverted) > 0 {
+		ev := Event{
+			Type: ReorgEvent,
+			Slot: t.nodeSet[ancestor].Slot,
+			Node: fmt.Sprintf("%x", ancestor)}
+		for _, nh := range reverted {
+			ev.Reverted = append(ev.Reverted, fmt.Sprintf("%x", nh))
+		}
+		events = append(events, ev)
+	}
+
+	for _, nh := range applied {
+		n := t.nodeSet[nh]
+		for _, id := range n.TransList {
+			if tran, found := t.delivered.GetTransaction(id); found {
+				events = append(events, Event{
+					Type:        TransactionEvent,
+					Slot:        n.Slot,
+					Node:        fmt.Sprintf("%x", nh),
+					Transaction: &tran})
+			}
+		}
+	}
+
+	for _, account := range changedAccounts(before, t.ledger) {
+		events = append(events, Event{
+			Type:    BalanceEvent,
+			Account: account,
+			Balance: t.ledger.GetBalance(account)})
+	}
+
+	events = append(events, Event{
+		Type: HeadEvent,
+		Slot: t.nodeSet[t.head].Slot,
+		Node: fmt.Sprintf("%x", t.head)})
+
+	for _, f := range t.subscribers {
+		f(events)
+	}
+}
+
+// branches returns the nodes leaving the chain moving the head from old to new (newest first),
+// the ones joining it (oldest first) and their common ancestor
+func (t *Tree) branches(old, new nodeHash) ([]nodeHash, []nodeHash, nodeHash) {
+	onOld := map[nodeHash]bool{t.genesis: true}
+	for nh := old; !eqH(nh, t.genesis); nh = t.getParent(nh) {
+		onOld[nh] = true
+	}
+
+	applied := []nodeHash{}
+	ancestor := new
+	for ; !onOld[ancestor]; ancestor = t.getParent(ancestor) {
+		applied = append([]nodeHash{ancestor}, applied...)
+	}
+
+	reverted := []nodeHash{}
+	for nh := old; !eqH(nh, ancestor); nh = t.getParent(nh) {
+		reverted = append(reverted, nh)
+	}
+
+	return reverted, applied, ancestor
+}
+
+// changedAccounts returns the accounts whose balance differs between the two ledgers
+func changedAccounts(before, after *Ledger) []string {
+	changed := []string{}
+	seen := map[string]bool{}
+
+	for _, account := range append(after.GetSortedKeys(), before.GetSortedKeys()...) {
+		if !seen[account] && before.GetBalance(account) != after.GetBalance(account) {
+			changed = append(changed, account)
+		}
+		seen[account] = true
+	}
+	return changed
+}
@@ -0,0 +1,75 @@
+package blocktree
+
+import (
+	"fmt"
+	"testing"
+
+	. "../account"
+)
+
+func TestEventsFollowTheHead(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+	genesis := tree.GetHead()
+
+	var events []Event
+	tree.Subscribe(func(evs []Event) { events = append(events, evs...) })
+
+	tree.ConsiderTransaction(NewTransaction("pay", "founder", "bob", 100), []string{})
+	n1 := NewNode(42, 1, []string{"pay"}, signer, genesis)
+	if !tree.ConsiderLeaf(n1) {
+		t.Fatal("Node not added")
+	}
+
+	if len(events) == 0 || events[len(events)-1].Type != HeadEvent || events[len(events)-1].Node != fmt.Sprintf("%x", HashNode(n1)) {
+		t.Fatal("New head not notified", events)
+	}
+	if events[0].Type != TransactionEvent || events[0].Transaction.ID != "pay" {
+		t.Error("Applied transaction not notified", events)
+	}
+	balances := map[string]uint64{}
+	for _, ev := range events {
+		if ev.Type == BalanceEvent {
+			balances[ev.Account] = ev.Balance
+		}
+	}
+	if balances["bob"] != 99 || balances["founder"] != 1e6-100 || len(balances) != 3 {
+		t.Error("Wrong balance changes", balances)
+	}
+
+	// a longer fork reverts n1 and its transaction
+	events = nil
+	f1 := NewNode(42, 2, []string{}, signer, genesis)
+	f2 := NewNode(42, 3, []string{}, signer, f1)
+	tree.ConsiderLeaf(f1)
+	tree.ConsiderLeaf(f2)
+
+	reverted := false
+	for _, ev := range events {
+		if ev.Type == ReorgEvent {
+			reverted = reverted || (len(ev.Reverted) == 1 && ev.Reverted[0] == fmt.Sprintf("%x", HashNode(n1)) && ev.Slot == 0)
+		}
+		if ev.Type == TransactionEvent {
+			t.Error("Transaction of the fork notified", ev)
+		}
+		if ev.Type == BalanceEvent {
+			balances[ev.Account] = ev.Balance
+		}
+	}
+	if !reverted {
+		t.Error("Reorganization not notified", events)
+	}
+	if last := events[len(events)-1]; last.Type != HeadEvent || last.Slot != 3 {
+		t.Error("Wrong head notified", last)
+	}
+	if balances["bob"] != 0 || balances["founder"] != 1e6 {
+		t.Error("Reverted balances not notified", balances)
+	}
+
+	// a shorter fork changes nothing
+	events = nil
+	tree.ConsiderLeaf(NewNode(42, 4, []string{}, signer, genesis))
+	if len(events) != 0 {
+		t.Error("Events for a fork", events)
+	}
+}
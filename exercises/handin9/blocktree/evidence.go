@@ -0,0 +1,95 @@
+package blocktree
+
+import (
+	"bytes"
+	"fmt"
+
+	. "../account"
+)
+
+// Evidence proves that a peer signed two different nodes for the same slot (equivocation),
+// once included in a node the whole stake of the offender is burned
+type Evidence struct {
+	First  SignedNode
+	Second SignedNode
+}
+
+// NewEvidence creates the evidence of two conflicting nodes, sorted so that it is the same whoever detects it
+func NewEvidence(sn1, sn2 SignedNode) Evidence {
+	h1, h2 := HashNode(&sn1.Node), HashNode(&sn2.Node)
+	if bytes.Compare(h1[:], h2[:]) > 0 {
+		sn1, sn2 = sn2, sn1
+	}
+
+	return Evidence{
+		First:  sn1,
+		Second: sn2}
+}
+
+// Verify checks that the two nodes are different, signed by the same peer for the same slot
+func (ev Evidence) Verify() bool {
+	n1, n2 := &ev.First.Node, &ev.Second.Node
+	h1, h2 := HashNode(n1), HashNode(n2)
+
+	return n1.Peer == n2.Peer && n1.Slot == n2.Slot && bytes.Compare(h1[:], h2[:]) < 0 &&
+		ev.First.VerifyNode() && ev.Second.VerifyNode()
+}
+
+// Offender returns the account of the peer who equivocated
+func (ev Evidence) Offender() string {
+	return AddressFromKey(ev.First.Peer)
+}
+
+// Slot returns the slot of the equivocation
+func (ev Evidence) Slot() uint64 {
+	return ev.First.Slot
+}
+
+// key identifies the offence, the stake is burned once whatever pair of nodes proves it
+func (ev Evidence) key() string {
+	return fmt.Sprint(ev.Slot(), ev.First.Peer)
+}
+
+// VerifyEvidence checks all the evidence included in the node
+func (n *Node) VerifyEvidence() bool {
+	for _, ev := range n.Evidence {
+		if !ev.Verify() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckEvidence returns true if the offences proved by the node (parent must be in the tree)
+// are not already punished by its ancestors nor repeated
+func (t *Tree) CheckEvidence(n *Node) bool {
+	return len(t.NewEvidence(n.getParent(t), n.Evidence)) == len(n.Evidence)
+}
+
+// NewEvidence filters the evidence of the offences not punished on the path from the genesis to the node
+func (t *Tree) NewEvidence(n *Node, evidence []Evidence) []Evidence {
+	punished := map[string]bool{}
+
+	// evidence can't be included before the offence, so the walk stops at the oldest one
+	oldest := n.Slot
+	for _, ev := range evidence {
+		if ev.Slot() < oldest {
+			oldest = ev.Slot()
+		}
+	}
+
+	for node := n; node != nil && node.Slot >= oldest; node = node.getParent(t) {
+		for _, ev := range node.Evidence {
+			punished[ev.key()] = true
+		}
+	}
+
+	fresh := []Evidence{}
+	for _, ev := range evidence {
+		if !punished[ev.key()] {
+			punished[ev.key()] = true
+			fresh = append(fresh, ev)
+		}
+	}
+	return fresh
+}
@@ -0,0 +1,72 @@
+package blocktree
+
+import (
+	"testing"
+
+	. "../account"
+	"../aesrsa"
+)
+
+func newTestSigner(t *testing.T) aesrsa.Signer {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestEvidenceVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+
+	n1 := NewNode(42, 7, []string{"a"}, signer, tree.GetHead())
+	n2 := NewNode(42, 7, []string{"b"}, signer, tree.GetHead())
+	sn1, sn2 := *NewSignedNode(*n1, signer), *NewSignedNode(*n2, signer)
+
+	ev := NewEvidence(sn1, sn2)
+	if !ev.Verify() {
+		t.Error("Conflicting nodes not accepted as evidence")
+	}
+	if swapped := NewEvidence(sn2, sn1); HashNode(&swapped.First.Node) != HashNode(&ev.First.Node) {
+		t.Error("Evidence depends on the order of the nodes")
+	}
+	if NewEvidence(sn1, sn1).Verify() {
+		t.Error("The same node accepted as evidence")
+	}
+
+	n3 := NewNode(42, 8, []string{"b"}, signer, tree.GetHead())
+	if NewEvidence(sn1, *NewSignedNode(*n3, signer)).Verify() {
+		t.Error("Nodes of different slots accepted as evidence")
+	}
+
+	forged := NewEvidence(sn1, *NewSignedNode(*n2, newTestSigner(t)))
+	if forged.Verify() {
+		t.Error("Node signed by another key accepted as evidence")
+	}
+}
+
+func TestEvidencePunishedOnce(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+
+	sn1 := *NewSignedNode(*NewNode(42, 7, []string{"a"}, signer, tree.GetHead()), signer)
+	sn2 := *NewSignedNode(*NewNode(42, 7, []string{"b"}, signer, tree.GetHead()), signer)
+	ev := NewEvidence(sn1, sn2)
+
+	n := NewNode(42, 8, []string{}, signer, tree.GetHead())
+	n.Evidence = []Evidence{ev, ev}
+	if tree.CheckEvidence(n) {
+		t.Error("Repeated evidence accepted")
+	}
+
+	n.Evidence = []Evidence{ev}
+	if !tree.CheckEvidence(n) || !tree.ConsiderLeaf(n) {
+		t.Fatal("Node with evidence not accepted")
+	}
+
+	next := NewNode(42, 9, []string{}, signer, n)
+	next.Evidence = []Evidence{ev}
+	if tree.CheckEvidence(next) {
+		t.Error("Evidence accepted twice on the same chain")
+	}
+}
@@ -0,0 +1,45 @@
+package blocktree
+
+import (
+	"../metrics"
+)
+
+// treeMetrics are the counters updated by the tree
+type treeMetrics struct {
+	nodesAdded   metrics.Counter
+	forkSwitches metrics.Counter
+}
+
+// RegisterMetrics adds the metrics of the tree to the registry
+func (t *Tree) RegisterMetrics(r *metrics.Registry) {
+	r.Register("blocktree_nodes_added_total", "Nodes added to the tree, forks included.", &t.metrics.nodesAdded)
+	r.Register("blocktree_fork_switches_total", "Times the head moved to another branch, rebuilding the ledger from the genesis.", &t.metrics.forkSwitches)
+
+	r.Register("blocktree_nodes", "Nodes in the tree.", t.locked(func() float64 {
+		return float64(len(t.nodeSet))
+	}))
+	r.Register("blocktree_leafs", "Leafs of the tree, one per fork.", t.locked(func() float64 {
+		return float64(len(t.leafs))
+	}))
+	r.Register("blocktree_head_slot", "Slot of the head of the chain.", t.locked(func() float64 {
+		return float64(t.nodeSet[t.head].Slot)
+	}))
+	r.Register("blocktree_current_slot", "Current slot of the local clock.", metrics.GaugeFunc(func() float64 {
+		return float64(t.GetCurrentSlot())
+	}))
+	r.Register("blocktree_chain_transactions", "Transactions in the chain of the head, deriv() gives the transactions per second.", metrics.GaugeFunc(func() float64 {
+		return float64(t.delivered.Len())
+	}))
+	r.Register("blocktree_pending_transactions", "Transactions received but not in the chain of the head (mempool).", metrics.GaugeFunc(func() float64 {
+		return float64(t.received.Len())
+	}))
+}
+
+// locked reads the tree while holding the lock
+func (t *Tree) locked(f func() float64) metrics.GaugeFunc {
+	return func() float64 {
+		t.lock.RLock()
+		defer t.lock.RUnlock()
+		return f()
+	}
+}
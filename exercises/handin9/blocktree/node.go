@@ -19,15 +19,16 @@ type Node struct {
 	CreatedStake []Transaction
 	TransList    []string //ids
 	Parent       nodeHash
+	Evidence     []Evidence `json:",omitempty"` // equivocations punished by this node
 }
 
 // NewNode given slot number and transactions
-func NewNode(seed, slot uint64, transList []string, keys *aesrsa.RSAKeyPair, parent *Node) *Node {
+func NewNode(seed, slot uint64, transList []string, signer aesrsa.Signer, parent *Node) *Node {
 	return &Node{
 		Seed:      seed,
 		Slot:      slot,
-		Peer:      aesrsa.KeyToString(keys.Public),
-		Draw:      getDraw(slot, seed, keys.Private),
+		Peer:      aesrsa.VerifierToString(signer.Verifier()),
+		Draw:      getDraw(slot, seed, signer),
 		TransList: transList,
 		Parent:    parent.hash()}
 }
@@ -38,14 +39,35 @@ func (n *Node) getParent(t *Tree) *Node { //maybe needs locks
 	return val
 }
 
+// VerifyDraw checks that the Draw is the VRF proof of (slot, seed) under the key of the peer
+func (n *Node) VerifyDraw() bool {
+	_, ok := n.drawOutput()
+	return ok
+}
+
+// drawOutput returns the VRF output of the Draw if its proof is valid
+func (n *Node) drawOutput() ([]byte, bool) {
+	verifier, err := aesrsa.VerifierFromString(n.Peer)
+	if err != nil {
+		return nil, false
+	}
+
+	return verifier.VerifyProof(drawInput(n.Slot, n.Seed), n.Draw)
+}
+
 func (n *Node) valueOfDraw(t *Tree) *big.Int {
 	var val big.Int
 
+	beta, ok := n.drawOutput()
+	if !ok {
+		return &val
+	}
+
 	json1, err := json.Marshal(n.Slot)
 	check(err)
 	json2, err := json.Marshal(n.Seed)
 	check(err)
-	json3, err := json.Marshal(n.Draw)
+	json3, err := json.Marshal(beta)
 	check(err)
 	json4, err := json.Marshal(n.Peer)
 	check(err)
@@ -57,28 +79,43 @@ func (n *Node) valueOfDraw(t *Tree) *big.Int {
 
 	hashInt := new(big.Int).SetBytes(hash[:])
 
-	return val.Mul(hashInt, big.NewInt(t.getStake(n.Peer)))
+	return val.Mul(hashInt, big.NewInt(t.getStake(n.account())))
 }
 
 //utils
 
+// account returns the ledger address of the peer who made the node
+func (n *Node) account() string {
+	return AddressFromKey(n.Peer)
+}
+
 func (n *Node) hash() nodeHash {
 	return HashNode(n)
 }
 
-func getDraw(slot, seed uint64, sk aesrsa.RSAKey) []byte {
+// getDraw returns the lottery ticket as VRF proof, nil if the key can't compute one
+func getDraw(slot, seed uint64, signer aesrsa.Signer) []byte {
+	proof, err := signer.Prove(drawInput(slot, seed))
+	if err != nil {
+		return nil
+	}
+
+	return proof
+}
+
+func drawInput(slot, seed uint64) []byte {
 	json1, err := json.Marshal(slot)
 	check(err)
 	json2, err := json.Marshal(seed)
 	check(err)
 
-	return aesrsa.SignRSA(append(json1, json2...), sk)
+	return append(json1, json2...)
 }
 
 func (n *Node) string(t *Tree) string {
 	s := ""
 	s += fmt.Sprintln("Slot:", n.Slot)
-	s += fmt.Sprintln("Peer:", n.Peer[30:39])
+	s += fmt.Sprintln("Peer:", n.account())
 	s += fmt.Sprintln("Parent:", n.Parent)
 	s += fmt.Sprint("Value:", n.valueOfDraw(t))
 
@@ -14,11 +14,11 @@ type SignedNode struct {
 }
 
 // NewSignedNode creates a SignedNode from a node
-func NewSignedNode(node Node, sk aesrsa.RSAKey) *SignedNode {
+func NewSignedNode(node Node, signer aesrsa.Signer) *SignedNode {
 	jsonT, err := json.Marshal(node)
 	check(err)
 
-	sign := base64.StdEncoding.EncodeToString(aesrsa.SignRSA(jsonT, sk))
+	sign := base64.StdEncoding.EncodeToString(signer.Sign(jsonT))
 
 	return &SignedNode{
 		Node:      node,
@@ -32,12 +32,14 @@ func (sn SignedNode) VerifyNode() bool {
 	check(err)
 
 	sign, err := base64.StdEncoding.DecodeString(sn.Signature)
-	check(err)
+	if err != nil {
+		return false
+	}
 
-	return aesrsa.VerifyRSA(jsonT, sign, aesrsa.KeyFromString(n.Peer))
-}
+	verifier, err := aesrsa.VerifierFromString(n.Peer)
+	if err != nil {
+		return false
+	}
 
-// WhatType returns "SignedNode" for SignedNode type
-func (sn SignedNode) WhatType() string {
-	return "SignedNode"
+	return verifier.Verify(jsonT, sign)
 }
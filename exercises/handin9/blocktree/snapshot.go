@@ -0,0 +1,102 @@
+package blocktree
+
+import (
+	"fmt"
+	"sort"
+
+	. "../account"
+)
+
+// NodeInfo describes a node of the tree, as shown by the block explorer
+type NodeInfo struct {
+	Hash         string
+	Parent       string
+	Slot         uint64
+	Account      string // of the peer who created it
+	Transactions []Transaction
+	Offenders    []string // accounts burned by the evidence in the node
+	Leaf         bool
+	OnChain      bool // on the path from the genesis to the head
+}
+
+// Snapshot is a copy of the tree and of the ledger of the head
+type Snapshot struct {
+	Genesis  string
+	Head     string
+	Slot     uint64 // current slot
+	Nodes    []NodeInfo
+	Balances map[string]uint64
+}
+
+// Snapshot copies the nodes not older than since (the genesis is always included) sorted by slot
+func (t *Tree) Snapshot(since uint64) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	onChain := map[nodeHash]bool{t.genesis: true}
+	for nh := t.head; !eqH(nh, t.genesis); nh = t.getParent(nh) {
+		onChain[nh] = true
+	}
+
+	leafs := map[nodeHash]bool{}
+	for _, l := range t.leafs {
+		leafs[l] = true
+	}
+
+	s := Snapshot{
+		Genesis:  t.GetGenesisID(),
+		Head:     fmt.Sprintf("%x", t.head),
+		Slot:     t.GetCurrentSlot(),
+		Nodes:    []NodeInfo{},
+		Balances: map[string]uint64{}}
+
+	for nh, n := range t.nodeSet {
+		if n.Slot < since && !eqH(nh, t.genesis) {
+			continue
+		}
+
+		info := NodeInfo{
+			Hash:         fmt.Sprintf("%x", nh),
+			Slot:         n.Slot,
+			Account:      n.Peer,
+			Transactions: n.CreatedStake,
+			Offenders:    []string{},
+			Leaf:         leafs[nh],
+			OnChain:      onChain[nh]}
+
+		if !eqH(nh, t.genesis) {
+			info.Parent = fmt.Sprintf("%x", n.Parent)
+			info.Account = n.account()
+			info.Transactions = t.transactions(n)
+		}
+		for _, ev := range n.Evidence {
+			info.Offenders = append(info.Offenders, ev.Offender())
+		}
+
+		s.Nodes = append(s.Nodes, info)
+	}
+	sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].Slot < s.Nodes[j].Slot })
+
+	for _, address := range t.ledger.GetSortedKeys() {
+		s.Balances[address] = t.ledger.GetBalance(address)
+	}
+
+	return s
+}
+
+// transactions returns the transactions of the node, just the ID of the ones never received
+func (t *Tree) transactions(n *Node) []Transaction {
+	list := []Transaction{}
+
+	for _, id := range n.TransList {
+		tran, found := t.delivered.GetTransaction(id)
+		if !found {
+			tran, found = t.received.GetTransaction(id)
+		}
+		if !found {
+			tran = Transaction{ID: id}
+		}
+		list = append(list, tran)
+	}
+	return list
+}
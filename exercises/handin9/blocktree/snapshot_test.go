@@ -0,0 +1,45 @@
+package blocktree
+
+import (
+	"fmt"
+	"testing"
+
+	. "../account"
+)
+
+func TestSnapshotMarksChainAndForks(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+	genesis := tree.GetHead()
+
+	n1 := NewNode(42, 1, []string{}, signer, genesis)
+	n2 := NewNode(42, 2, []string{"unknown"}, signer, n1)
+	fork := NewNode(42, 3, []string{}, signer, genesis)
+	for _, n := range []*Node{n1, n2, fork} {
+		if !tree.ConsiderLeaf(n) {
+			t.Fatal("Node not added")
+		}
+	}
+
+	s := tree.Snapshot(0)
+	if len(s.Nodes) != 4 || s.Head != fmt.Sprintf("%x", HashNode(n2)) {
+		t.Fatal("Wrong snapshot", s)
+	}
+
+	expected := []struct{ onChain, leaf bool }{{true, false}, {true, false}, {true, true}, {false, true}}
+	for i, info := range s.Nodes {
+		if info.OnChain != expected[i].onChain || info.Leaf != expected[i].leaf {
+			t.Error("Wrong status of the node of slot", info.Slot)
+		}
+	}
+	if trans := s.Nodes[2].Transactions; len(trans) != 1 || trans[0].ID != "unknown" {
+		t.Error("Unknown transaction not listed by ID", trans)
+	}
+	if s.Balances["founder"] != 1e6 {
+		t.Error("Wrong balances", s.Balances)
+	}
+
+	if s := tree.Snapshot(3); len(s.Nodes) != 2 || s.Nodes[0].Slot != 0 || s.Nodes[1].Slot != 3 {
+		t.Error("Old nodes not filtered", s.Nodes)
+	}
+}
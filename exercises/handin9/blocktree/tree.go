@@ -1,9 +1,11 @@
 package blocktree
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	. "../account"
@@ -44,12 +46,24 @@ type Tree struct {
 	// SlotLength is the time duration of the Slot
 	SlotLength time.Duration
 
+	// Clock gives the local time, the slots are derived from it
+	Clock Clock
+
+	// offset of the local clock from the one of the network in nanoseconds (atomic)
+	offset int64
+
 	// Reward is the reward for each node won
 	reward uint64
 
 	// Fee is the fee for each transaction payed to the peer who is responsible for its node
 	fee uint64
 
+	// counters exposed by RegisterMetrics
+	metrics treeMetrics
+
+	// subscribers are notified of the updates of the head, see events.go
+	subscribers []func(events []Event)
+
 	// lock for synchronization
 	lock sync.RWMutex
 }
@@ -74,6 +88,7 @@ func NewTree(initTrans []Transaction) *Tree {
 		ledger:     NewLedger(),
 		hardness:   new(big.Int).Exp(big.NewInt(2), big.NewInt(255+12), nil), //255 for the hash mean and 12 for the stake
 		SlotLength: 1 * time.Second,
+		Clock:      RealClock{},
 		reward:     10,
 		fee:        1}
 
@@ -107,28 +122,100 @@ func (t *Tree) GetSeed() uint64 { //maybe needs locks
 	return t.getNode(t.head).Seed
 }
 
-// GetHead returns
+// GetGenesisID returns the hash of the genesis node identifying the network
+func (t *Tree) GetGenesisID() string {
+	return hex.EncodeToString(t.genesis[:])
+}
+
+// GetHead returns the current head of the chain
 func (t *Tree) GetHead() *Node {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
 	return t.nodeSet[t.head]
 }
 
+// CheckSeed returns true if the node carries the seed of its parent, which must be in the tree
+func (t *Tree) CheckSeed(n *Node) bool {
+	parent := n.getParent(t)
+	return parent != nil && n.Seed == parent.Seed
+}
+
 // CheckIsNext returns true if the node can be considered for addition false if it could be a future one
 func (t *Tree) CheckIsNext(n *Node) bool {
 	return n.getParent(t) != nil
 }
 
+// HasNode returns true if the node is already in the tree
+func (t *Tree) HasNode(n *Node) bool {
+	_, found := t.nodeSet[n.hash()]
+	return found
+}
+
+// MissingTransactions returns the IDs of the transactions of the node never received
+func (t *Tree) MissingTransactions(n *Node) []string {
+	missing := []string{}
+
+	for _, id := range n.TransList {
+		_, received := t.received.GetTransaction(id)
+		_, delivered := t.delivered.GetTransaction(id)
+		if !received && !delivered {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
+// InChain returns true if the transaction is applied to the ledger of the head
+func (t *Tree) InChain(id string) bool {
+	_, found := t.delivered.GetTransaction(id)
+	return found
+}
+
+// Inclusion returns the node of the chain of the head including the transaction
+// and the number of nodes on top of it
+func (t *Tree) Inclusion(id string) (*Node, uint64, bool) {
+	if !t.InChain(id) {
+		return nil, 0, false
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	depth := uint64(0)
+	for nh := t.head; !eqH(nh, t.genesis); nh = t.getParent(nh) {
+		n := t.nodeSet[nh]
+		for _, tid := range n.TransList {
+			if tid == id {
+				return n, depth, true
+			}
+		}
+		depth++
+	}
+	return nil, 0, false
+}
+
 // ConsiderLeaf tries to add a node to the tree as leaf (hence should be the winner)
 // and return true if succeeds (the node should be discarded otherwise)
 func (t *Tree) ConsiderLeaf(n *Node) bool {
 
 	// Verify its consistency
+	//// not already added
+	if t.HasNode(n) {
+		return false
+	}
 	//// younger than parent
 	if n.Slot <= n.getParent(t).Slot {
 		return false
 	}
 
-	// add to tree
+	// add to tree, the lock keeps the snapshots consistent
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	t.addLeaf(n)
+	t.metrics.nodesAdded.Inc()
 	// update state
 	t.updateLedger()
 
@@ -147,7 +234,7 @@ func (t *Tree) ConsiderTransaction(tran Transaction, seq []string) bool {
 		newTran, _ := t.deductFees(val, "")
 
 		// Apply transaction
-		t.ledger.Transaction(newTran)
+		tmpLedger.Transaction(newTran)
 
 	}
 
@@ -159,17 +246,57 @@ func (t *Tree) GetLedger() string {
 	return t.ledger.String()
 }
 
-// GetAccountNumbers return the list ok pubkeys in the ledger
+// RegisterMultisig registers a multisig account in the ledger and returns its address
+func (t *Tree) RegisterMultisig(m MultisigAccount) string {
+	return t.ledger.RegisterMultisig(m)
+}
+
+// GetMultisig returns the multisig account with the given address if registered
+func (t *Tree) GetMultisig(address string) (MultisigAccount, bool) {
+	return t.ledger.GetMultisig(address)
+}
+
+// GetBalance returns the balance of an account in the current ledger
+func (t *Tree) GetBalance(address string) uint64 {
+	return t.ledger.GetBalance(address)
+}
+
+// GetAccountNumbers return the list of addresses in the ledger
 func (t *Tree) GetAccountNumbers() []string {
 	return t.ledger.GetSortedKeys()
 }
 
 // GetCurrentSlot returns the current slot number
 func (t *Tree) GetCurrentSlot() uint64 {
-	slot := time.Now().UnixNano() / int64(t.SlotLength)
+	return t.SlotAt(t.Now())
+}
+
+// SetTimeOffset sets how much the local clock is behind the one of the network
+func (t *Tree) SetTimeOffset(offset time.Duration) {
+	atomic.StoreInt64(&t.offset, int64(offset))
+}
+
+// Now returns the time of the network as estimated by the local machine
+func (t *Tree) Now() time.Time {
+	return t.Clock.Now().Add(time.Duration(atomic.LoadInt64(&t.offset)))
+}
+
+// AfterSlot returns a channel receiving the time once the slot started since delay
+func (t *Tree) AfterSlot(slot uint64, delay time.Duration) <-chan time.Time {
+	return t.Clock.After(t.SlotStart(slot).Add(delay).Sub(t.Now()))
+}
+
+// SlotAt returns the number of the slot at the given time
+func (t *Tree) SlotAt(tm time.Time) uint64 {
+	slot := tm.UnixNano() / int64(t.SlotLength)
 	return uint64(slot)
 }
 
+// SlotStart returns the time the slot starts
+func (t *Tree) SlotStart(slot uint64) time.Time {
+	return time.Unix(0, int64(slot)*int64(t.SlotLength))
+}
+
 // BelongsToCurrentSlot checks if the node has current slot number
 func (t *Tree) BelongsToCurrentSlot(n *Node) bool {
 	return t.GetCurrentSlot() == n.Slot
@@ -196,8 +323,8 @@ func (t *Tree) addLeaf(n *Node) {
 
 	if found { // if parent is one of the leafs just replace it with ph
 		t.leafs[index] = nh
-		//sort comparing to the next one
-		if index > 0 && t.compareWeight(t.leafs[index], t.leafs[index-1]) {
+		//sort comparing to the previous ones
+		for ; index > 0 && t.compareWeight(t.leafs[index], t.leafs[index-1]); index-- {
 			t.leafs[index-1], t.leafs[index] = t.leafs[index], t.leafs[index-1]
 		}
 		return
@@ -206,6 +333,7 @@ func (t *Tree) addLeaf(n *Node) {
 	////// if it is not, add a new leaf a the correct sorted position
 
 	// find correct position (could be binary search but too much effort)
+	index = len(t.leafs)
 	for i := range t.leafs {
 		if t.compareWeight(nh, t.leafs[i]) {
 			index = i
@@ -257,14 +385,21 @@ func (t *Tree) getStake(peer string) int64 { //maybe needs locks
 // UpdateLedger recreates ledger up to the current head
 // responsible for managin head
 func (t *Tree) updateLedger() {
+	oldHead := t.head
+	var before *Ledger
+	if len(t.subscribers) > 0 {
+		before = t.ledger.Copy()
+	}
+
 	path, found := t.pathFromTo(t.head, t.leafs[0])
 
 	if !found {
 		// New path from root
+		t.metrics.forkSwitches.Inc()
 		path, _ = t.pathFromTo(t.genesis, t.leafs[0])
 		path = append([]nodeHash{t.genesis}, path...)
 		// Recreate ledger
-		t.ledger = NewLedger()
+		t.ledger.Reset()
 
 		// Reset delivered: delivered = empty, received = received U delivered
 		t.delivered.TransferAll(t.received)
@@ -281,6 +416,10 @@ func (t *Tree) updateLedger() {
 	}
 
 	t.head = t.leafs[0]
+
+	if before != nil {
+		t.notify(oldHead, before)
+	}
 }
 
 // ApplyAllTransactions applies a node to the ledger and consider reward
@@ -297,7 +436,7 @@ func (t *Tree) applyAllTransactions(node *Node) {
 		tran, found := t.received.GetTransaction(id)
 		if found {
 			// Apply transaction, fees from receiver!
-			newTran, feeTran := t.deductFees(tran, node.Peer)
+			newTran, feeTran := t.deductFees(tran, node.account())
 			t.ledger.Transaction(newTran)
 			t.ledger.Transaction(feeTran)
 
@@ -310,7 +449,11 @@ func (t *Tree) applyAllTransactions(node *Node) {
 		}
 	}
 
-	t.ledger.AddToBalance(node.Peer, t.reward)
+	t.ledger.AddToBalance(node.account(), t.reward)
+
+	for _, ev := range node.Evidence {
+		t.ledger.Burn(ev.Offender())
+	}
 }
 
 // PathFromTo returns the path between two nodes (excluding from, including to, if equal its empty) if it exists otherwise (nil, false)
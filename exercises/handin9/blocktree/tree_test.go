@@ -0,0 +1,66 @@
+package blocktree
+
+import (
+	"testing"
+
+	. "../account"
+)
+
+func TestConsiderTransactionKeepsTheLedger(t *testing.T) {
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+
+	tree.ConsiderTransaction(NewTransaction("1", "founder", "someone", 100), []string{})
+	if !tree.ConsiderTransaction(NewTransaction("2", "founder", "someone", 100), []string{"1"}) {
+		t.Error("Transaction refused with enough balance")
+	}
+	if tree.GetBalance("founder") != 1e6 || tree.GetBalance("someone") != 0 {
+		t.Error("The ledger of the head changed by checking a sequence", tree.GetBalance("founder"))
+	}
+
+	if tree.ConsiderTransaction(NewTransaction("3", "founder", "someone", 1e6), []string{"1"}) {
+		t.Error("Transaction accepted after the sequence spent the balance")
+	}
+}
+
+func TestExtendedLeafBecomesHead(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+	genesis := tree.GetHead()
+
+	// three branches of the same length
+	for slot := uint64(1); slot <= 3; slot++ {
+		n := NewNode(42, slot, []string{}, signer, genesis)
+		tree.ConsiderLeaf(n)
+		tree.ConsiderLeaf(NewNode(42, slot+10, []string{}, signer, n))
+	}
+
+	// the last one in the order of the leafs, extended, overtakes the two others at once
+	last := tree.getNode(tree.leafs[len(tree.leafs)-1])
+	next := NewNode(42, 20, []string{}, signer, last)
+	if !tree.ConsiderLeaf(next) {
+		t.Fatal("Node not added")
+	}
+	if !eqH(HashNode(tree.GetHead()), HashNode(next)) {
+		t.Error("The longest branch is not the head")
+	}
+}
+
+func TestShorterForkIsNotHead(t *testing.T) {
+	signer := newTestSigner(t)
+	tree := NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)})
+	genesis := tree.GetHead()
+
+	a := NewNode(42, 1, []string{}, signer, genesis)
+	tree.ConsiderLeaf(a)
+	b := NewNode(42, 2, []string{}, signer, a)
+	tree.ConsiderLeaf(b)
+
+	// the parent of the fork is not a leaf, its place is searched among all the leafs
+	tree.ConsiderLeaf(NewNode(42, 3, []string{}, signer, genesis))
+	if !eqH(HashNode(tree.GetHead()), HashNode(b)) {
+		t.Error("A shorter fork became the head")
+	}
+	if len(tree.leafs) != 2 {
+		t.Error("Wrong leafs", len(tree.leafs))
+	}
+}
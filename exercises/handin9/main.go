@@ -1,21 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
-	"time"
+	"strconv"
 
 	"gopkg.in/alecthomas/kingpin.v2"
-	"k8s.io/apimachinery/pkg/util/wait"
 
 	. "./account"
 	"./aesrsa"
+	"./agent"
 	bt "./blocktree"
 	. "./peers"
 	serv "./services"
+	"./transport"
 )
 
-var localKeys *aesrsa.RSAKeyPair
+var localSigner aesrsa.Signer
+
+// signingAgent holds the keys of the user if --agent is given
+var signingAgent *agent.Client
 
 func main() {
 
@@ -23,6 +35,27 @@ func main() {
 		keys = kingpin.Flag("keys", "Use predefined keys.").Short('k').String()
 		pw   = kingpin.Flag("password", "Password for the keys").Short('x').String()
 		dir  = kingpin.Flag("dir", "Directory for the founders' keys. (Must already exist)").Short('d').Default("founders").String()
+		alg  = kingpin.Flag("algorithm", "Signature algorithm of generated keys.").Short('a').Default("rsa").Enum("rsa", "ed25519", "ecdsa")
+
+		agentSock = kingpin.Flag("agent", "Unix socket of the signing agent holding the keys.").String()
+		agentKey  = kingpin.Flag("agent-key", "Address of the agent's key to use (default the key of the first wallet given to the agent).").String()
+
+		bans = kingpin.Flag("bans", "File where the peers banned for misbehaving are saved.").Default("bans.json").String()
+
+		listen    = kingpin.Flag("listen", "Address to accept peers on as host:port, port 0 picks a free one (default all interfaces on the server port, or a free port for a peer).").String()
+		advertise = kingpin.Flag("advertise", "Address announced to the peers as host:port, either part can be empty (default the first interface and the listening port).").String()
+
+		explorer = kingpin.Flag("explorer", "Address to serve the block explorer web page on as host:port (disabled by default).").PlaceHolder("HOST:PORT").String()
+
+		metricsAddr = kingpin.Flag("metrics", "Address to serve the Prometheus metrics on as host:port (disabled by default).").PlaceHolder("HOST:PORT").String()
+
+		eventsSock = kingpin.Flag("events", "Unix socket streaming the events of the chain as lines of JSON (disabled by default).").PlaceHolder("SOCKET").String()
+
+		logLevel  = kingpin.Flag("log-level", "Minimum level of the events logged.").Default("info").Enum("debug", "info", "warn", "error")
+		logFormat = kingpin.Flag("log-format", "Format of the events logged.").Default("text").Enum("text", "json")
+		logFile   = kingpin.Flag("log-file", "File the events are appended to (default the standard error, the prompt uses the standard output).").String()
+
+		adversary = kingpin.Flag("adversary", "Misbehave on purpose to test the defences of the honest peers.").PlaceHolder("MODE").Enum(serv.AdversaryModes...)
 
 		server     = kingpin.Command("server", "Create your own network.")
 		portServer = server.Flag("port", "Port of server.").Short('p').Default("4444").Int()
@@ -30,100 +63,352 @@ func main() {
 		peer = kingpin.Command("peer", "Connect to a peer in a pre-existing network.")
 		ip   = peer.Arg("ip", "IP address of Peer.").Required().IP()
 		port = peer.Arg("port", "Port of Peer.").Required().Int()
+
+		bench       = kingpin.Command("bench", "Measure how fast payments of the founders submitted to some nodes get confirmed by all of them.")
+		benchNodes  = bench.Arg("nodes", "Addresses of the block explorers of the nodes as host:port (see --explorer).").Required().Strings()
+		benchRate   = bench.Flag("rate", "Transactions submitted per second, spread over the nodes.").Default("10").Float64()
+		benchTime   = bench.Flag("time", "Duration of the load.").Default("30s").Duration()
+		benchSettle = bench.Flag("settle", "Time the last transactions have to be confirmed.").Default("10s").Duration()
+		benchPayers = bench.Flag("payers", "Number of founders paying each other (their keys must be in --dir).").Default("10").Int()
+
+		receipt     = kingpin.Command("receipt", "Ask a running node what happened to the transactions sent from its keyboard (the node must run with --explorer).")
+		receiptNode = receipt.Flag("node", "Address of the block explorer of the node as host:port (see --explorer).").Default("127.0.0.1:8080").String()
+		receiptID   = receipt.Arg("id", "ID of the transaction (default all).").String()
+
+		events      = kingpin.Command("events", "Follow the events of the chain streamed by a running node.")
+		followSock  = events.Flag("socket", "Unix socket of the node (see --events).").Default("events.sock").String()
+		eventsWatch = events.Flag("watch", "Account whose balance changes are streamed (repeatable).").Strings()
+
+		wallet     = kingpin.Command("wallet", "Create a wallet with a new key protected by a password.")
+		walletFile = wallet.Arg("file", "Wallet file to create.").Required().String()
+
+		agentCmd    = kingpin.Command("agent", "Run a signing agent holding the keys of some wallets.")
+		socket      = agentCmd.Flag("socket", "Unix socket to listen on.").Default("agent.sock").String()
+		policyFile  = agentCmd.Flag("policy", "JSON file mapping addresses to signing policies.").String()
+		walletFiles = agentCmd.Arg("wallets", "Wallet files to load.").Required().ExistingFiles()
 	)
 
 	kingpin.CommandLine.HelpFlag.Short('h')
 
 	cmd := kingpin.Parse()
+	initLogger(*logLevel, *logFormat, *logFile)
+
+	algorithm, err := aesrsa.ParseAlgorithm(*alg)
+	if err != nil {
+		panic(err)
+	}
+
+	switch cmd {
+	case "wallet":
+		createWallet(*walletFile, *pw, algorithm)
+		return
+	case "agent":
+		runAgent(*socket, *walletFiles, *policyFile)
+		return
+	case "receipt":
+		queryReceipts(*receiptNode, *receiptID)
+		return
+	case "bench":
+		runBench(serv.BenchConfig{
+			Nodes:  *benchNodes,
+			Rate:   *benchRate,
+			Load:   *benchTime,
+			Settle: *benchSettle,
+			Payers: ReadFounderSigners(*benchPayers, *dir)})
+		return
+	case "events":
+		followEvents(*followSock, *eventsWatch)
+		return
+	}
 
 	serv.InitNetwork()
 
-	listenCh := make(chan SignedTransaction)
-	blockCh := make(chan bt.SignedNode)
+	if cmd == "server" {
+		if _, err := os.Stat(*dir); err != nil && os.IsNotExist(err) {
+			GenerateFounders(10, *dir, algorithm)
+		}
+	}
+
+	// the genesis identifies the network in the handshake
+	tree := InitBlockChain(*dir)
+	initKeys(*keys, *pw, algorithm, *agentSock, *agentKey)
+	checkDraw(tree, localSigner)
+
+	node := serv.NewNode(tree, localSigner, transport.TCP{})
+	node.SigningAgent = signingAgent
+	node.Adversary = serv.Adversary(*adversary)
+	node.InitBans(*bans)
 
 	switch cmd {
 	case "server":
-		if _, err := os.Stat(*dir); err != nil && os.IsNotExist(err) {
-			os.Mkdir(*dir, 0755)
-			GenerateFounders(10, *dir)
+		if *listen == "" {
+			*listen = ":" + strconv.Itoa(*portServer)
 		}
-		initKeys(*keys, *pw)
-		serv.CreateNetwork(*portServer, listenCh, blockCh, localKeys.Public)
+		node.Listen(*listen)
+		node.CreateNetwork(*advertise)
 	case "peer":
+		if *listen == "" {
+			*listen = ":0"
+		}
 		firstPeer := Peer{
 			IP:   ip.String(),
 			Port: *port}
-		initKeys(*keys, *pw)
-		serv.ConnectToNetwork(firstPeer, listenCh, blockCh, localKeys.Public)
+		node.Listen(*listen)
+		node.ConnectToNetwork(firstPeer, *advertise)
 	}
 
-	InitBlockChain(*dir)
-	startServices(listenCh, blockCh)
-}
-
-func startServices(listenCh chan SignedTransaction, blockCh chan bt.SignedNode) {
-	sequencerCh := make(chan Transaction)
-	quitCh := make(chan struct{})
+	if *explorer != "" {
+		node.ServeExplorer(*explorer)
+	}
+	if *metricsAddr != "" {
+		node.ServeMetrics(*metricsAddr)
+	}
+	if *eventsSock != "" {
+		node.ServeEvents(*eventsSock)
+	}
 
-	serv.Wg.Add(1)
-	go serv.BeServer(listenCh, blockCh, quitCh)
+	startServices(node)
+}
 
-	wait.PollInfinite(time.Second*5, wait.ConditionFunc(func() (bool, error) {
-		return serv.PeerList.Length() > 1, nil
-	}))
+func startServices(node *serv.Node) {
+	node.Start()
 
-	serv.Wg.Add(3)
-	go serv.ProcessTransactions(listenCh, sequencerCh, quitCh)
-	go serv.ProcessNodes(sequencerCh, blockCh, localKeys, quitCh)
-	go serv.Write(listenCh, quitCh)
+	// the keyboard is used once part of a network
+	if node.WaitForPeers() {
+		node.Wg.Add(1)
+		go node.Write()
+	}
 
-	<-quitCh
-	serv.Connect(&serv.LocalPeer)
-	serv.Wg.Wait()
+	node.Wait()
 }
 
 /////////// Init Functions ///////////
 
-func initKeys(keys, pw string) {
-	if keys != "" && pw != "" {
-		localKeys = aesrsa.ReadKeyPair(keys, pw)
+// initLogger sets the default logger, used by all the packages for their events
+// (the prompt and the keys are printed on the standard output instead)
+func initLogger(level, format, file string) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		panic(err.Error())
+	}
+
+	out := io.Writer(os.Stderr)
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			panic(err.Error())
+		}
+		out = f
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	if format == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(out, opts)))
 	} else {
-		var err error
-		localKeys, err = aesrsa.KeyGen(2048)
+		slog.SetDefault(slog.New(slog.NewTextHandler(out, opts)))
+	}
+}
+
+// initKeys gets the node's key from the agent, a key file or generates a new one
+// the secret key is printed only if just generated, as there is no other way to retrieve it
+func initKeys(keys, pw string, alg aesrsa.Algorithm, agentSock, agentKey string) {
+	var err error
+
+	switch {
+	case agentSock != "":
+		signingAgent, err = agent.Dial(agentSock)
+		if err != nil {
+			panic(err.Error())
+		}
+		localSigner, err = signingAgent.Signer(agentKey)
 		if err != nil {
 			panic(err.Error())
 		}
+		slog.Info("Using the key held by the agent", "socket", agentSock)
+	case keys != "" && pw != "":
+		localSigner = aesrsa.ReadSigner(keys, pw)
+	default:
+		localSigner, err = aesrsa.GenerateSigner(alg)
+		if err != nil {
+			panic(err.Error())
+		}
+		fmt.Println("Your secret key is (use a wallet and the agent to avoid this):")
+		fmt.Println(aesrsa.SignerToString(localSigner))
 	}
 
-	fmt.Println("Your secret key is:")
-	fmt.Println(aesrsa.KeyToString(localKeys.Private))
+	pubKey := aesrsa.VerifierToString(localSigner.Verifier())
 	fmt.Println("Your public key is:")
-	fmt.Println(aesrsa.KeyToString(localKeys.Public))
+	fmt.Println(pubKey)
+	fmt.Println("Your address is:", AddressFromKey(pubKey))
 }
 
-// GenerateFounders creates n founders' keys and and write the pairs and just the public in files
-func GenerateFounders(n int, dir string) {
+// checkDraw refuses a key with stake that can't draw the lottery (see aesrsa/vrf.go), its node would never win
+func checkDraw(tree *bt.Tree, signer aesrsa.Signer) {
+	address := AddressFromKey(aesrsa.VerifierToString(signer.Verifier()))
+	if _, err := signer.Prove([]byte("draw")); err != nil && tree.GetBalance(address) > 0 {
+		panic("The account " + address + " has stake but its key can't draw the lottery: " + err.Error())
+	}
+}
+
+// runBench prints the throughput and the latency of the payments confirmed by the nodes
+func runBench(cfg serv.BenchConfig) {
+	fmt.Println("Submitting", cfg.Rate, "transactions per second for", cfg.Load, "to", len(cfg.Nodes), "nodes")
+	fmt.Println(serv.Bench(cfg))
+}
+
+// queryReceipts prints the receipts served by the node at address
+func queryReceipts(address, id string) {
+	res, err := http.Get("http://" + address + "/receipts?id=" + url.QueryEscape(id))
+	if err != nil {
+		fmt.Println("Could not reach the node, the receipts are served with its block explorer (run it with --explorer " + address + "):")
+		fmt.Println(err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		fmt.Print(string(msg))
+		return
+	}
+
+	var receipts []serv.Receipt
+	if err := json.NewDecoder(res.Body).Decode(&receipts); err != nil {
+		panic(err.Error())
+	}
+	if len(receipts) == 0 {
+		fmt.Println("No transactions sent")
+	}
+	for _, rc := range receipts {
+		fmt.Println(rc)
+	}
+}
+
+// followEvents subscribes to the events of a node and prints them as they come
+func followEvents(socket string, watch []string) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(serv.Subscription{Watch: watch}); err != nil {
+		panic(err.Error())
+	}
+
+	lines := bufio.NewScanner(conn)
+	for lines.Scan() {
+		fmt.Println(lines.Text())
+	}
+}
+
+/////////// Wallet and Agent ///////////
+
+func createWallet(file, pw string, alg aesrsa.Algorithm) {
+	if pw == "" {
+		pw = askPassword(bufio.NewScanner(os.Stdin), file)
+	}
+
+	pubKey := aesrsa.GenerateWallet(file, pw, alg)
+
+	fmt.Println("Wallet created, the public key is:")
+	fmt.Println(pubKey)
+	fmt.Println("The address is:", AddressFromKey(pubKey))
+}
+
+// runAgent decrypts the wallets and serves signatures until "quit" is typed
+func runAgent(socket string, wallets []string, policyFile string) {
+	policies := map[string]agent.Policy{}
+	if policyFile != "" {
+		var err error
+		policies, err = agent.ReadPolicies(policyFile)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	a := agent.NewAgent()
+
+	for _, w := range wallets {
+		signer, err := aesrsa.OpenWallet(w, askPassword(scanner, w))
+		if err != nil {
+			panic(err.Error())
+		}
+
+		address := AddressFromKey(aesrsa.VerifierToString(signer.Verifier()))
+		policy, found := policies[address]
+		if !found {
+			policy = agent.DefaultPolicy
+		}
+		a.AddKey(signer, policy)
+		slog.Info("Loaded key", "account", address, "policy", policy)
+	}
+
+	quitCh := make(chan struct{})
+	go func() {
+		for scanner.Scan() && scanner.Text() != "quit" {
+		}
+		close(quitCh)
+	}()
+
+	fmt.Println("Agent listening on", socket, "(type quit to stop)")
+	if err := a.Serve(socket, quitCh); err != nil {
+		panic(err.Error())
+	}
+}
+
+func askPassword(scanner *bufio.Scanner, file string) string {
+	fmt.Println("Password for", file+":")
+	scanner.Scan()
+	return scanner.Text()
+}
+
+// GenerateFounders creates n founders' keys and and write the pairs and just the public in files of dir, created
+func GenerateFounders(n int, dir string, alg aesrsa.Algorithm) {
+	signers := []aesrsa.Signer{}
 	for i := 0; i < n; i++ {
-		keys, err := aesrsa.KeyGen(2048)
+		signer, err := aesrsa.GenerateSigner(alg)
 		if err != nil {
 			panic(err)
 		}
+		// the founders have stake, their keys must draw the lottery
+		if _, err := signer.Prove([]byte("draw")); err != nil {
+			panic("The founders' keys can't be " + string(alg) + ": " + err.Error())
+		}
+		signers = append(signers, signer)
+	}
 
+	os.Mkdir(dir, 0755)
+	for i, signer := range signers {
 		privFile := fmt.Sprintf(dir+"/"+"founder-%d.keys", i)
 		pw := fmt.Sprintf("password-%d", i)
-		aesrsa.StoreKeyPair(keys, privFile, pw)
+		aesrsa.StoreSigner(signer, privFile, pw)
 
 		pubFile := fmt.Sprintf(dir+"/"+"founder-%d.cert", i)
 		pw2 := "nopassword"
-		aesrsa.StoreKey(keys.Public, pubFile, pw2)
+		aesrsa.StoreVerifier(signer.Verifier(), pubFile, pw2)
 	}
 }
 
+// ReadFounderSigners returns the keys of the first n founders, as stored by GenerateFounders
+func ReadFounderSigners(n int, dir string) []aesrsa.Signer {
+	signers := []aesrsa.Signer{}
+
+	for i := 0; i < n; i++ {
+		privFile := fmt.Sprintf(dir+"/"+"founder-%d.keys", i)
+		pw := fmt.Sprintf("password-%d", i)
+		signers = append(signers, aesrsa.ReadSigner(privFile, pw))
+	}
+
+	return signers
+}
+
 // InitBlockChain make the necessary preparetions for the blockchain
-func InitBlockChain(dir string) {
+func InitBlockChain(dir string) *bt.Tree {
 	founders := ReadPublicKeys(10, dir)
 	tl := InitTransactions(founders)
-	serv.Tree = bt.NewTree(tl)
+	return bt.NewTree(tl)
 }
 
 // ReadPublicKeys returns the list of founders' public keys
@@ -133,9 +418,9 @@ func ReadPublicKeys(n int, dir string) []string {
 	for i := 0; i < n; i++ {
 
 		pubFile := fmt.Sprintf(dir+"/"+"founder-%d.cert", i)
-		key := aesrsa.ReadKey(pubFile, "nopassword")
+		key := aesrsa.ReadVerifier(pubFile, "nopassword")
 
-		founders = append(founders, aesrsa.KeyToString(*key))
+		founders = append(founders, aesrsa.VerifierToString(key))
 	}
 
 	return founders
@@ -147,7 +432,7 @@ func InitTransactions(founders []string) []Transaction {
 
 	for i, f := range founders {
 		id := fmt.Sprintf("Genesis - %d", i)
-		list = append(list, NewTransaction(id, "Genesis", f, 1e6))
+		list = append(list, NewTransaction(id, "Genesis", AddressFromKey(f), 1e6))
 	}
 
 	return list
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a value that only grows, the zero value is ready to use
+type Counter struct {
+	value uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that goes up and down, the zero value is ready to use
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds v (can be negative) to the gauge
+func (g *Gauge) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the gauge
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// GaugeFunc is a gauge whose value is computed when the metrics are read
+type GaugeFunc func() float64
+
+// Histogram counts the observations falling in buckets, each bucket has an upper bound
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative, the last is +Inf
+	sum    Gauge
+	count  Counter
+}
+
+// DurationBuckets are the bounds in seconds suited for the duration of cryptographic operations
+var DurationBuckets = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1}
+
+// NewHistogram is the constructor of Histogram, the bounds are sorted
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1)}
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	h.sum.Add(v)
+	h.count.Inc()
+}
+
+// ObserveSince adds the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// CounterVec is a set of counters distinguished by the value of a label
+type CounterVec struct {
+	label    string
+	counters map[string]*Counter
+	lock     sync.RWMutex
+}
+
+// NewCounterVec is the constructor of CounterVec
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{
+		label:    label,
+		counters: map[string]*Counter{}}
+}
+
+// With returns the counter of the value of the label, creating it if needed
+func (v *CounterVec) With(value string) *Counter {
+	v.lock.RLock()
+	c, found := v.counters[value]
+	v.lock.RUnlock()
+	if found {
+		return c
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if c, found = v.counters[value]; !found {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
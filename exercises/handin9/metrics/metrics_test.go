@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := &Counter{}
+	c.Add(3)
+	g := &Gauge{}
+	g.Set(1.5)
+	g.Add(-2)
+	h := NewHistogram([]float64{1, 0.1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 7} {
+		h.Observe(v)
+	}
+	v := NewCounterVec("type")
+	v.With("node").Inc()
+	v.With(`a"b`).Add(2)
+
+	r.Register("c_total", "A counter\nwith two lines.", c)
+	r.Register("g", "A gauge.", g)
+	r.Register("f", "A function.", GaugeFunc(func() float64 { return 42 }))
+	r.Register("h_seconds", "A histogram.", h)
+	r.Register("v_total", "A vector.", v)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP c_total A counter\nwith two lines.
+# TYPE c_total counter
+c_total 3
+# HELP f A function.
+# TYPE f gauge
+f 42
+# HELP g A gauge.
+# TYPE g gauge
+g -0.5
+# HELP h_seconds A histogram.
+# TYPE h_seconds histogram
+h_seconds_bucket{le="0.1"} 2
+h_seconds_bucket{le="1"} 3
+h_seconds_bucket{le="+Inf"} 4
+h_seconds_sum 7.65
+h_seconds_count 4
+# HELP v_total A vector.
+# TYPE v_total counter
+v_total{type="a\"b"} 2
+v_total{type="node"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("Wrong exposition:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.Register("c_total", "", &Counter{})
+
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(err.(string), "twice") {
+			t.Error("Duplicated metric accepted", err)
+		}
+	}()
+	r.Register("c_total", "", &Counter{})
+}
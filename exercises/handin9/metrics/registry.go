@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds the metrics of a node and writes them in the Prometheus text format
+type Registry struct {
+	entries map[string]entry
+	lock    sync.RWMutex
+}
+
+type entry struct {
+	help   string
+	metric interface{}
+}
+
+// NewRegistry is the constructor of Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: map[string]entry{}}
+}
+
+// Register adds a *Counter, *Gauge, GaugeFunc, *Histogram or *CounterVec with its name
+// (snake case with the unit as suffix, _total for counters) and description
+func (r *Registry) Register(name, help string, metric interface{}) {
+	switch metric.(type) {
+	case *Counter, *Gauge, GaugeFunc, *Histogram, *CounterVec:
+	default:
+		panic(fmt.Sprintf("metric %s of unknown type %T", name, metric))
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.entries[name]; found {
+		panic("metric " + name + " registered twice")
+	}
+	r.entries[name] = entry{help: help, metric: metric}
+}
+
+// WriteText writes all the metrics sorted by name in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	names := []string{}
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		e := r.entries[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(e.help))
+
+		switch m := e.metric.(type) {
+		case *Counter:
+			fmt.Fprintf(bw, "# TYPE %s counter\n%s %d\n", name, name, m.Value())
+		case *Gauge:
+			fmt.Fprintf(bw, "# TYPE %s gauge\n%s %s\n", name, name, formatFloat(m.Value()))
+		case GaugeFunc:
+			fmt.Fprintf(bw, "# TYPE %s gauge\n%s %s\n", name, name, formatFloat(m()))
+		case *Histogram:
+			fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+			writeHistogram(bw, name, m)
+		case *CounterVec:
+			fmt.Fprintf(bw, "# TYPE %s counter\n", name)
+			writeCounterVec(bw, name, m)
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics to the Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+func writeHistogram(w io.Writer, name string, h *Histogram) {
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), cumulative)
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.bounds)])
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum.Value()))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count.Value())
+}
+
+func writeCounterVec(w io.Writer, name string, v *CounterVec) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	values := []string{}
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, v.label, escapeLabel(value), v.counters[value].Value())
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"sort"
 	"sync"
+	"time"
 )
 
 // AtomicSortedSlice is a synchronized []Peer type
@@ -29,10 +30,10 @@ func (aslice *AtomicSortedSlice) AddPeerFromConn(conn net.Conn) Peer {
 	return p
 }
 
-// find search the slice for an element and return its index
+// find search the slice for an element (by address) and return its index
 func (aslice *AtomicSortedSlice) find(peer *Peer) (int, error) {
 	i := sort.Search(len(aslice.data), func(i int) bool { return peer.less(aslice.data[i]) }) - 1
-	if i >= 0 && i < len(aslice.data) && aslice.data[i] == peer {
+	if i >= 0 && i < len(aslice.data) && aslice.data[i].GetAddress() == peer.GetAddress() {
 		return i, nil
 	}
 	return i + 1, errors.New("Not found, but i is the index where it would be inserted")
@@ -43,6 +44,11 @@ func (aslice *AtomicSortedSlice) SortedInsert(peer *Peer) int {
 	aslice.rwLock.Lock()
 	defer aslice.rwLock.Unlock()
 
+	return aslice.insert(peer)
+}
+
+// insert is SortedInsert without locking
+func (aslice *AtomicSortedSlice) insert(peer *Peer) int {
 	l := len(aslice.data)
 	if l == 0 {
 		aslice.data = []*Peer{peer}
@@ -71,6 +77,69 @@ func (aslice *AtomicSortedSlice) SortedInsert(peer *Peer) int {
 	return i
 }
 
+// Merge adds the unknown peers and refreshes the last-seen time of the known ones,
+// it returns the number of peers added. Their keys are ignored, as the gossip is not authenticated:
+// a key is only learned on a handshake
+func (aslice *AtomicSortedSlice) Merge(peers []Peer) int {
+	aslice.rwLock.Lock()
+	defer aslice.rwLock.Unlock()
+
+	added := 0
+	for _, p := range peers {
+		i, err := aslice.find(&p)
+		if err != nil {
+			aslice.insert(&Peer{IP: p.IP, Port: p.Port, LastSeen: p.LastSeen})
+			added++
+			continue
+		}
+
+		known := aslice.data[i]
+		if p.LastSeen.After(known.LastSeen) {
+			known.LastSeen = p.LastSeen
+		}
+	}
+	return added
+}
+
+// Seen sets the last-seen time of a peer
+func (aslice *AtomicSortedSlice) Seen(peer *Peer, t time.Time) {
+	aslice.rwLock.Lock()
+	defer aslice.rwLock.Unlock()
+
+	peer.LastSeen = t
+}
+
+// Prune removes the peers without a connection not seen since the given time, returns how many were removed
+func (aslice *AtomicSortedSlice) Prune(since time.Time) int {
+	aslice.rwLock.Lock()
+	defer aslice.rwLock.Unlock()
+
+	kept := make([]*Peer, 0, len(aslice.data))
+	for _, value := range aslice.data {
+		if value.Connected() || !value.LastSeen.Before(since) {
+			kept = append(kept, value)
+		}
+	}
+
+	removed := len(aslice.data) - len(kept)
+	aslice.data = kept
+	return removed
+}
+
+// Snapshot returns a copy of the peers, the most recently seen first
+func (aslice *AtomicSortedSlice) Snapshot() []Peer {
+	aslice.rwLock.RLock()
+	defer aslice.rwLock.RUnlock()
+
+	peers := make([]Peer, 0, len(aslice.data))
+	for _, value := range aslice.data {
+		peers = append(peers, value.snapshot())
+	}
+
+	sort.SliceStable(peers, func(i, j int) bool { return peers[i].LastSeen.After(peers[j].LastSeen) })
+	return peers
+}
+
 // Iter iterates over the items in the concurrent slice
 // Each item is sent over a channel, so that
 // we can iterate over the slice using the builin range keyword
@@ -125,8 +194,8 @@ func (aslice *AtomicSortedSlice) IterConn() <-chan net.Conn {
 		aslice.rwLock.RLock()
 		defer aslice.rwLock.RUnlock()
 		for _, value := range aslice.data {
-			if value.conn != nil {
-				c <- value.conn
+			if conn := value.getLink().conn; conn != nil {
+				c <- conn
 			}
 		}
 		close(c)
@@ -144,11 +213,8 @@ func (aslice *AtomicSortedSlice) IterEnc() <-chan *gob.Encoder {
 		aslice.rwLock.RLock()
 		defer aslice.rwLock.RUnlock()
 		for _, value := range aslice.data {
-			if value.conn != nil {
-				if value.enc == nil {
-					value.enc = gob.NewEncoder(value.conn)
-				}
-				c <- value.enc
+			if value.Connected() {
+				c <- value.GetEnc()
 			}
 
 		}
@@ -165,13 +231,39 @@ func (aslice *AtomicSortedSlice) GetPeerByConn(conn net.Conn) *Peer {
 	defer aslice.rwLock.RUnlock()
 
 	for _, value := range aslice.data {
-		if value.conn == conn {
+		if value.getLink().conn == conn {
 			return value
 		}
 	}
 	return &Peer{}
 }
 
+// GetPeer returns the peer with the given address (IP:Port), nil if unknown
+func (aslice *AtomicSortedSlice) GetPeer(address string) *Peer {
+	aslice.rwLock.RLock()
+	defer aslice.rwLock.RUnlock()
+
+	for _, value := range aslice.data {
+		if value.GetAddress() == address {
+			return value
+		}
+	}
+	return nil
+}
+
+// GetKey returns the key of the peer with the given address, empty if unknown or not known yet
+func (aslice *AtomicSortedSlice) GetKey(address string) string {
+	aslice.rwLock.RLock()
+	defer aslice.rwLock.RUnlock()
+
+	for _, value := range aslice.data {
+		if value.GetAddress() == address {
+			return value.PubKey
+		}
+	}
+	return ""
+}
+
 // AddConn finds peer in slice and adds net.Conn to it
 func (aslice *AtomicSortedSlice) AddConn(peer *Peer, conn net.Conn) *Peer {
 	aslice.rwLock.RLock()
@@ -186,6 +278,33 @@ func (aslice *AtomicSortedSlice) AddConn(peer *Peer, conn net.Conn) *Peer {
 	return aslice.data[i]
 }
 
+// Attach sets the connection of a peer unless it got connected meanwhile, returns false in that case.
+// update (if not nil) sets the other fields of the peer before, under the lock as the peer is shared
+func (aslice *AtomicSortedSlice) Attach(peer *Peer, conn net.Conn, enc *gob.Encoder, dec *gob.Decoder, update func(p *Peer)) bool {
+	aslice.rwLock.Lock()
+	defer aslice.rwLock.Unlock()
+
+	if peer.Connected() {
+		return false
+	}
+
+	if update != nil {
+		update(peer)
+	}
+	peer.AddConn(conn)
+	peer.AddEnc(enc)
+	peer.AddDec(dec)
+	return true
+}
+
+// Disconnect closes and forgets the connection of a peer, synchronized with the iterations
+func (aslice *AtomicSortedSlice) Disconnect(peer *Peer) {
+	aslice.rwLock.Lock()
+	defer aslice.rwLock.Unlock()
+
+	peer.Disconnect()
+}
+
 // Remove a peer from the slice
 func (aslice *AtomicSortedSlice) Remove(peer *Peer) {
 	aslice.rwLock.Lock()
@@ -0,0 +1,61 @@
+package peers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	now := time.Now()
+	list := NewList()
+	list.SortedInsert(&Peer{IP: "10.0.0.1", Port: 1, LastSeen: now.Add(-time.Hour)})
+
+	added := list.Merge([]Peer{
+		{IP: "10.0.0.1", Port: 1, LastSeen: now, PubKey: "gossiped key"},
+		{IP: "10.0.0.2", Port: 1, LastSeen: now, PubKey: "gossiped key"},
+		{IP: "10.0.0.0", Port: 1, LastSeen: now}})
+
+	if added != 2 || list.Length() != 3 {
+		t.Fatal("Expected 2 new peers, got", added, "with length", list.Length())
+	}
+
+	known := list.GetPeer("10.0.0.1:1")
+	if known == nil || !known.LastSeen.Equal(now) {
+		t.Error("Last seen of a known peer not refreshed")
+	}
+	if known.PubKey != "" || list.GetPeer("10.0.0.2:1").PubKey != "" {
+		t.Error("Key taken from the gossip")
+	}
+
+	list.Merge([]Peer{{IP: "10.0.0.1", Port: 1, LastSeen: now.Add(-2 * time.Hour)}})
+	if !known.LastSeen.Equal(now) {
+		t.Error("Last seen went back in time")
+	}
+
+	prev := ""
+	for p := range list.Iter() {
+		if prev >= p.GetAddress() {
+			t.Error("List not sorted:", prev, p.GetAddress())
+		}
+		prev = p.GetAddress()
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	list := NewList()
+	list.Merge([]Peer{
+		{IP: "10.0.0.1", Port: 1, LastSeen: now.Add(-time.Hour)},
+		{IP: "10.0.0.2", Port: 1, LastSeen: now}})
+
+	if removed := list.Prune(now.Add(-time.Minute)); removed != 1 {
+		t.Fatal("Expected 1 peer pruned, got", removed)
+	}
+	if list.GetPeer("10.0.0.2:1") == nil {
+		t.Error("Recent peer pruned")
+	}
+
+	if snap := list.Snapshot(); len(snap) != 1 || snap[0].GetAddress() != "10.0.0.2:1" {
+		t.Error("Unexpected snapshot", snap)
+	}
+}
@@ -0,0 +1,84 @@
+package peers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// BanList is a synchronized set of banned identities (IPs or public keys) with the end of their ban,
+// saved to a file so that bans survive restarts
+type BanList struct {
+	bans map[string]time.Time
+	file string
+	lock sync.RWMutex
+}
+
+// NewBanList is the constructor of the BanList type, it loads the bans still valid from file
+// (an empty file name keeps the list in memory only)
+func NewBanList(file string) *BanList {
+	b := &BanList{
+		bans: make(map[string]time.Time),
+		file: file}
+
+	if file == "" {
+		return b
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Could not read the ban list", "file", file, "err", err)
+		}
+		return b
+	}
+
+	if err := json.Unmarshal(data, &b.bans); err != nil {
+		slog.Warn("Could not read the ban list", "file", file, "err", err)
+	}
+
+	now := time.Now()
+	for addr, until := range b.bans {
+		if now.After(until) {
+			delete(b.bans, addr)
+		}
+	}
+
+	return b
+}
+
+// Ban bans the identity for the given duration and saves the list
+func (b *BanList) Ban(address string, d time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.bans[address] = time.Now().Add(d)
+	b.save()
+}
+
+// IsBanned returns true if the identity is banned now
+func (b *BanList) IsBanned(address string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	until, found := b.bans[address]
+	return found && time.Now().Before(until)
+}
+
+// save writes the list to its file, must be called with the lock held
+func (b *BanList) save() {
+	if b.file == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(b.bans, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(b.file, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Could not save the ban list", "file", b.file, "err", err)
+	}
+}
@@ -0,0 +1,34 @@
+package peers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanListPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "bans.json")
+
+	b := NewBanList(file)
+	b.Ban("10.0.0.1:1", time.Hour)
+	b.Ban("10.0.0.2:1", -time.Second)
+
+	if !b.IsBanned("10.0.0.1:1") || b.IsBanned("10.0.0.2:1") || b.IsBanned("10.0.0.3:1") {
+		t.Fatal("Unexpected bans")
+	}
+
+	reloaded := NewBanList(file)
+	if !reloaded.IsBanned("10.0.0.1:1") {
+		t.Error("Ban lost after reload")
+	}
+	if _, found := reloaded.bans["10.0.0.2:1"]; found {
+		t.Error("Expired ban kept after reload")
+	}
+}
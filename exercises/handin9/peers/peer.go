@@ -5,39 +5,83 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 // Peer is an object representing peers connections
 type Peer struct {
-	IP     string
-	Port   int
-	PubKey string
-	conn   net.Conn
-	enc    *gob.Encoder
-	dec    *gob.Decoder
+	IP       string
+	Port     int
+	PubKey   string
+	LastSeen time.Time // last time the peer was known to be alive
+	caps     []string
+	outbound int32        // 1 if the connection was dialed by us (atomic)
+	link     atomic.Value // *link, the connection
+	writer   atomic.Value // *writer, the outbound queue, see queue.go
+	drops    int32
+	score    int32 // reputation, lowered on misbehaviour
+}
+
+// link is the connection of a peer with its codecs, it is replaced as a whole so that
+// it can be read while the peer connects or disconnects (which happens under the lock of the list)
+type link struct {
+	conn net.Conn
+	enc  *gob.Encoder
+	dec  *gob.Decoder
 }
 
 // newPeer is the constructor of the Peer type
 func newPeer(IP string, Port int, conn net.Conn) Peer {
-	return Peer{
+	p := Peer{
 		IP:   IP,
-		Port: Port,
-		conn: conn}
+		Port: Port}
+	p.AddConn(conn)
+	return p
+}
+
+// snapshot copies the peer without its writer, which is started outside of the lock of the list
+func (peer *Peer) snapshot() Peer {
+	p := Peer{
+		IP:       peer.IP,
+		Port:     peer.Port,
+		PubKey:   peer.PubKey,
+		LastSeen: peer.LastSeen,
+		caps:     peer.caps,
+		outbound: atomic.LoadInt32(&peer.outbound),
+		drops:    atomic.LoadInt32(&peer.drops),
+		score:    atomic.LoadInt32(&peer.score)}
+	p.AddConn(peer.getLink().conn)
+	return p
+}
+
+// getLink returns the connection of the peer, empty if it has none
+func (peer *Peer) getLink() *link {
+	if l, _ := peer.link.Load().(*link); l != nil {
+		return l
+	}
+	return &link{}
 }
 
 // AddConn sets a conn to an existing peer
 func (peer *Peer) AddConn(conn net.Conn) {
-	peer.conn = conn
+	l := *peer.getLink()
+	l.conn = conn
+	peer.link.Store(&l)
 }
 
 // AddEnc sets an encoder to an existing peer
 func (peer *Peer) AddEnc(enc *gob.Encoder) {
-	peer.enc = enc
+	l := *peer.getLink()
+	l.enc = enc
+	peer.link.Store(&l)
 }
 
 // AddDec sets an decoder to an existing peer
 func (peer *Peer) AddDec(dec *gob.Decoder) {
-	peer.dec = dec
+	l := *peer.getLink()
+	l.dec = dec
+	peer.link.Store(&l)
 }
 
 // AddPubKey sets a conn to an existing peer
@@ -45,9 +89,34 @@ func (peer *Peer) AddPubKey(key string) {
 	peer.PubKey = key
 }
 
-// GetAddress return the address of the peer as IP:Port
+// AddCapabilities sets the capabilities declared by the peer in the handshake
+func (peer *Peer) AddCapabilities(caps []string) {
+	peer.caps = caps
+}
+
+// HasCapability returns true if the peer declared the capability
+func (peer *Peer) HasCapability(c string) bool {
+	for _, pc := range peer.caps {
+		if pc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Penalize lowers the score of the peer and returns the new one
+func (peer *Peer) Penalize(points int) int {
+	return int(atomic.AddInt32(&peer.score, -int32(points)))
+}
+
+// Score returns the reputation of the peer, 0 unless it misbehaved
+func (peer *Peer) Score() int {
+	return int(atomic.LoadInt32(&peer.score))
+}
+
+// GetAddress return the address of the peer as IP:Port ([IP]:Port for IPv6)
 func (peer *Peer) GetAddress() string {
-	return peer.IP + ":" + peer.GetPort()
+	return net.JoinHostPort(peer.IP, peer.GetPort())
 }
 
 // GetPort return the address of the peer as IP:Port
@@ -57,25 +126,72 @@ func (peer *Peer) GetPort() string {
 
 // Close closees the connection of the peer
 func (peer *Peer) Close() {
-	peer.conn.Close()
+	if conn := peer.getLink().conn; conn != nil {
+		conn.Close()
+	}
+}
+
+// Disconnect closes the connection and forgets it so that the peer can be dialed again
+func (peer *Peer) Disconnect() {
+	peer.stopWriter()
+	peer.Close()
+	peer.link.Store(&link{})
+}
+
+// RemoteIP returns the IP the peer is connected from, empty without a connection
+func (peer *Peer) RemoteIP() string {
+	conn := peer.getLink().conn
+	if conn == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// Connected returns true if there is an open connection to the peer
+func (peer *Peer) Connected() bool {
+	return peer.getLink().conn != nil
+}
+
+// SetOutbound records if the connection was dialed by us
+func (peer *Peer) SetOutbound(outbound bool) {
+	var v int32
+	if outbound {
+		v = 1
+	}
+	atomic.StoreInt32(&peer.outbound, v)
+}
+
+// IsOutbound returns true if the connection was dialed by us
+func (peer *Peer) IsOutbound() bool {
+	return atomic.LoadInt32(&peer.outbound) == 1
 }
 
 // GetEnc return the encoder to the peer if available
 func (peer *Peer) GetEnc() *gob.Encoder {
-	if peer.enc == nil {
-		peer.enc = gob.NewEncoder(peer.conn)
+	l := peer.getLink()
+	if l.enc == nil {
+		enc := gob.NewEncoder(l.conn)
+		peer.AddEnc(enc)
+		return enc
 	}
 
-	return peer.enc
+	return l.enc
 }
 
 // GetDec return the decoder to the peer if available
 func (peer *Peer) GetDec() *gob.Decoder {
-	if peer.dec == nil {
-		peer.dec = gob.NewDecoder(peer.conn)
+	l := peer.getLink()
+	if l.dec == nil {
+		dec := gob.NewDecoder(l.conn)
+		peer.AddDec(dec)
+		return dec
 	}
 
-	return peer.dec
+	return l.dec
 }
 
 // Less defines an order relationshIP for peers
@@ -91,6 +207,6 @@ func (peer *Peer) less(peer2 *Peer) bool {
 	return false
 }
 
-func (peer Peer) String() string {
+func (peer *Peer) String() string {
 	return fmt.Sprintf("Peer: %s", peer.GetAddress())
 }
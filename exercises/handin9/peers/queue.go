@@ -0,0 +1,82 @@
+package peers
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// writer is the outbound queue of a connection, it is replaced as a whole so that
+// Send can read it while the connection changes
+type writer struct {
+	out  chan interface{}
+	done chan struct{} // closed when the writer stops
+}
+
+// getWriter returns the queue of the peer, nil if it has none
+func (peer *Peer) getWriter() *writer {
+	w, _ := peer.writer.Load().(*writer)
+	return w
+}
+
+// StartWriter creates the outbound queue of the peer and the goroutine writing it on the connection,
+// a write taking longer than timeout closes the connection
+func (peer *Peer) StartWriter(size int, timeout time.Duration) {
+	w := &writer{
+		out:  make(chan interface{}, size),
+		done: make(chan struct{})}
+	conn, enc := peer.getLink().conn, peer.GetEnc()
+
+	atomic.StoreInt32(&peer.drops, 0)
+	peer.writer.Store(w)
+
+	go func() {
+		for {
+			select {
+			case msg := <-w.out:
+				conn.SetWriteDeadline(time.Now().Add(timeout))
+				if err := enc.Encode(msg); err != nil {
+					conn.Close() // the reader notices and disconnects the peer
+					return
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// stopWriter stops the goroutine writing the queue, queued messages are lost
+func (peer *Peer) stopWriter() {
+	if w := peer.getWriter(); w != nil && peer.writer.CompareAndSwap(w, (*writer)(nil)) {
+		close(w.done)
+	}
+}
+
+// Send queues a message for the peer without waiting, it returns false if it was dropped
+// because there is no connection, the writer stopped or the queue is full
+func (peer *Peer) Send(msg interface{}) bool {
+	w := peer.getWriter()
+	if w == nil {
+		return false
+	}
+
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+
+	select {
+	case w.out <- msg:
+		atomic.StoreInt32(&peer.drops, 0)
+		return true
+	default:
+		atomic.AddInt32(&peer.drops, 1)
+		return false
+	}
+}
+
+// Drops returns the number of messages dropped in a row since the last one queued
+func (peer *Peer) Drops() int {
+	return int(atomic.LoadInt32(&peer.drops))
+}
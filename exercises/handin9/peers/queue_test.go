@@ -0,0 +1,79 @@
+package peers
+
+import (
+	"encoding/gob"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendWrites(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	p := &Peer{}
+	p.AddConn(local)
+	p.StartWriter(4, time.Second)
+	defer p.Disconnect()
+
+	if !p.Send("hello") {
+		t.Fatal("Message dropped")
+	}
+
+	var msg string
+	if err := gob.NewDecoder(remote).Decode(&msg); err != nil || msg != "hello" {
+		t.Error("Unexpected message", msg, err)
+	}
+}
+
+func TestSendDropsWhenFull(t *testing.T) {
+	w := &writer{out: make(chan interface{}, 1), done: make(chan struct{})}
+	p := &Peer{}
+	p.writer.Store(w)
+
+	if !p.Send(1) {
+		t.Fatal("First message dropped")
+	}
+	if p.Send(2) || p.Send(3) {
+		t.Fatal("Message queued on a full queue")
+	}
+	if p.Drops() != 2 {
+		t.Error("Expected 2 drops, got", p.Drops())
+	}
+
+	<-w.out
+	p.Send(4)
+	if p.Drops() != 0 {
+		t.Error("Drops not reset after a queued message")
+	}
+}
+
+func TestWriteTimeoutCloses(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	p := &Peer{}
+	p.AddConn(local)
+	p.StartWriter(4, 50*time.Millisecond)
+	p.Send("nobody reads")
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := local.Write([]byte{0}); err == nil {
+		t.Error("Connection still open after a write timeout")
+	}
+}
+
+func TestSendAfterStop(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	p := &Peer{}
+	p.AddConn(local)
+	p.StartWriter(4, time.Second)
+	p.Disconnect()
+	p.Disconnect()
+
+	if p.Send("late") {
+		t.Error("Message queued after the writer stopped")
+	}
+}
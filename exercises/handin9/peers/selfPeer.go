@@ -11,6 +11,7 @@ func GetLocalPeer(listeningPort int, pubKey string) Peer {
 	return p
 }
 
+// getLocalIP returns the first non-loopback IPv4 address, or the first global IPv6 one if there is none
 func getLocalIP() net.IP {
 	netInterfaceAddresses, err := net.InterfaceAddrs()
 
@@ -18,6 +19,8 @@ func getLocalIP() net.IP {
 		return nil
 	}
 
+	var ipv6 net.IP
+
 	for _, netInterfaceAddress := range netInterfaceAddresses {
 
 		networkIP, ok := netInterfaceAddress.(*net.IPNet)
@@ -25,6 +28,10 @@ func getLocalIP() net.IP {
 		if ok && !networkIP.IP.IsLoopback() && networkIP.IP.To4() != nil {
 			return networkIP.IP
 		}
+
+		if ok && ipv6 == nil && networkIP.IP.IsGlobalUnicast() {
+			ipv6 = networkIP.IP
+		}
 	}
-	return nil
+	return ipv6
 }
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"../aesrsa"
+	. "../peers"
+)
+
+// observedQuorum is the number of peers that must see us with the same IP before we advertise it
+const observedQuorum = 2
+
+// advertisedPeer returns the local peer as announced to the others: the advertise address (host:port,
+// both can be omitted) completed with the IP of the first interface and the listening port
+func (nd *Node) advertisedPeer(advertise string) *Peer {
+	_, listenPort, err := net.SplitHostPort(nd.listener.Addr().String())
+	if err != nil {
+		panic(err.Error())
+	}
+	lp, _ := strconv.Atoi(listenPort)
+
+	p := GetLocalPeer(lp, aesrsa.VerifierToString(nd.signer.Verifier()))
+	if advertise == "" {
+		return &p
+	}
+
+	host, port, err := net.SplitHostPort(advertise)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if host != "" {
+		p.IP = host
+		nd.advertiseFixed = true
+	}
+	if port != "" {
+		p.Port, err = strconv.Atoi(port)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+	return &p
+}
+
+// noteObserved records the IP the remote peer sees us with, it is advertised instead of ours once
+// observedQuorum peers (distinct proven keys) agree on it (unless set explicitly with --advertise)
+func (nd *Node) noteObserved(hs *Handshake) {
+	host, _, err := net.SplitHostPort(hs.Observed)
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil || ip.IsLoopback() || host == nd.LocalPeer().IP {
+		return
+	}
+
+	nd.observedLock.Lock()
+	defer nd.observedLock.Unlock()
+
+	if nd.observed[host] == nil {
+		nd.observed[host] = map[string]bool{}
+	}
+	nd.observed[host][hs.PubKey] = true
+
+	if nd.advertiseFixed || len(nd.observed[host]) < observedQuorum {
+		return
+	}
+
+	nd.Log.Info("Advertising the address seen by the peers", "ip", host, "peers", len(nd.observed[host]))
+	old := nd.LocalPeer()
+	local := &Peer{
+		IP:       host,
+		Port:     old.Port,
+		PubKey:   old.PubKey,
+		LastSeen: time.Now()}
+	nd.PeerList.Remove(old)
+	nd.setLocalPeer(local)
+	nd.PeerList.SortedInsert(local)
+	delete(nd.observed, host)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"math/rand"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+)
+
+// Adversary is a way of misbehaving on purpose, to exercise the defences of the honest peers
+type Adversary string
+
+// Adversary modes, Honest is the default
+const (
+	Honest      Adversary = ""
+	Equivocate  Adversary = "equivocate"   // signs two different nodes per slot
+	Withhold    Adversary = "withhold"     // never sends its nodes nor relays the others'
+	InvalidTx   Adversary = "invalid-tx"   // sends transactions with forged signatures every slot
+	DoubleSpend Adversary = "double-spend" // spends its balance twice every slot, to different halves of the peers
+	LieSlot     Adversary = "lie-slot"     // signs its nodes with a later slot
+)
+
+// AdversaryModes lists the names of the adversary modes
+var AdversaryModes = []string{string(Equivocate), string(Withhold), string(InvalidTx), string(DoubleSpend), string(LieSlot)}
+
+// lieSlotAhead is how many slots in the future the liar claims to be
+const lieSlotAhead = 2
+
+// Misbehave sends every slot the transactions of the InvalidTx and DoubleSpend modes
+func (nd *Node) Misbehave() {
+	defer nd.Wg.Done()
+
+	for {
+		select {
+		case <-nd.Tree.AfterSlot(nd.Tree.GetCurrentSlot()+1, 0):
+			switch nd.Adversary {
+			case InvalidTx:
+				nd.sendInvalidTransaction()
+			case DoubleSpend:
+				nd.doubleSpend()
+			}
+		case <-nd.quitCh:
+			return //Done
+		}
+	}
+}
+
+// ownSlot is the slot of the nodes made by the local machine, a liar claims a later one
+func (nd *Node) ownSlot() uint64 {
+	if nd.Adversary == LieSlot {
+		return nd.collectingSlot() + lieSlotAhead
+	}
+	return nd.collectingSlot()
+}
+
+// equivocate signs and sends a second node for the slot of n, without its last transaction
+func (nd *Node) equivocate(n *bt.Node) {
+	if len(n.TransList) == 0 {
+		return
+	}
+
+	twin := *n
+	twin.TransList = twin.TransList[:len(twin.TransList)-1]
+	nd.broadcastNode(*bt.NewSignedNode(twin, nd.signer))
+}
+
+// sendInvalidTransaction sends to every peer a payment whose signature doesn't match
+func (nd *Node) sendInvalidTransaction() {
+	others := nd.otherAccounts()
+	if len(others) == 0 {
+		return
+	}
+
+	t := nd.attachNextID(NewTransaction("", nd.ownAccount(), others[0], 2))
+	st := SignTransaction(t, nd.signer)
+	st.Amount++
+
+	nd.sendAll(Envelope{Type: TransactionMsg, Transaction: &st})
+}
+
+// doubleSpend pays the whole balance to two accounts, each payment is sent to half of the peers
+func (nd *Node) doubleSpend() {
+	balance := nd.Tree.GetBalance(nd.ownAccount())
+	others := nd.otherAccounts()
+	if balance < 2 || len(others) < 2 {
+		return
+	}
+
+	st1 := SignTransaction(nd.attachNextID(NewTransaction("", nd.ownAccount(), others[0], balance)), nd.signer)
+	st2 := SignTransaction(nd.attachNextID(NewTransaction("", nd.ownAccount(), others[1], balance)), nd.signer)
+
+	half := false
+	for p := range nd.PeerList.Iter() {
+		if !p.Connected() {
+			continue
+		}
+		if half {
+			nd.send(p, Envelope{Type: TransactionMsg, Transaction: &st2})
+		} else {
+			nd.send(p, Envelope{Type: TransactionMsg, Transaction: &st1})
+		}
+		half = !half
+	}
+}
+
+func (nd *Node) ownAccount() string {
+	return AddressFromKey(aesrsa.VerifierToString(nd.signer.Verifier()))
+}
+
+// otherAccounts returns the accounts of the ledger except ours in random order
+func (nd *Node) otherAccounts() []string {
+	others := []string{}
+	for _, a := range nd.Tree.GetAccountNumbers() {
+		if a != nd.ownAccount() {
+			others = append(others, a)
+		}
+	}
+
+	rand.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	return others
+}
+
+// withholds returns true if the item must not be sent to the peers
+func (nd *Node) withholds(item InvItem) bool {
+	return nd.Adversary == Withhold && item.Type == NodeMsg
+}
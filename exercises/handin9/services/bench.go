@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+)
+
+// benchPoll is how often Bench submits the transactions due and asks the nodes which ones they confirmed
+const benchPoll = 100 * time.Millisecond
+
+// benchTimeout bounds every request of Bench to a node
+const benchTimeout = 5 * time.Second
+
+// benchAmount is paid by every transaction of Bench, the fee included
+const benchAmount = 2
+
+// BenchConfig describes the load generated by Bench
+type BenchConfig struct {
+	Nodes  []string        // addresses of the explorers of the nodes (see ServeExplorer)
+	Rate   float64         // transactions per second, spread over the nodes
+	Load   time.Duration   // how long the transactions are submitted
+	Settle time.Duration   // how long the last ones can take to be confirmed
+	Payers []aesrsa.Signer // accounts paying each other, they must have balance
+}
+
+// BenchResult is what Bench measured, a transaction is confirmed once applied to
+// the ledger of the head of every node
+type BenchResult struct {
+	Nodes     int
+	Load      time.Duration
+	Submitted int
+	Refused   int // by the node they were submitted to
+	Confirmed int
+	Elapsed   time.Duration   // from the first submission to the last confirmation
+	Latencies []time.Duration // from the submission to the confirmation by the last node, sorted
+}
+
+// benchPending is a submitted transaction waiting for the confirmation of every node
+type benchPending struct {
+	submitted time.Time
+	confirmed map[int]bool // by index of the node
+}
+
+// Bench submits payments between the payers at the configured rate to each node in turn,
+// until Load plus at most Settle to wait for the pending ones to be confirmed by all the nodes
+func Bench(cfg BenchConfig) BenchResult {
+	accounts := []string{}
+	for _, p := range cfg.Payers {
+		accounts = append(accounts, AddressFromKey(aesrsa.VerifierToString(p.Verifier())))
+	}
+
+	client := &http.Client{Timeout: benchTimeout}
+	start := time.Now()
+	rnd := rand.New(rand.NewSource(start.UnixNano()))
+	result := BenchResult{Nodes: len(cfg.Nodes), Load: cfg.Load}
+	pending := map[string]*benchPending{}
+
+	ticker := time.NewTicker(benchPoll)
+	defer ticker.Stop()
+
+	for done := false; !done; {
+		now := <-ticker.C
+		elapsed := now.Sub(start)
+
+		for elapsed < cfg.Load && float64(result.Submitted) < cfg.Rate*elapsed.Seconds() {
+			from, to := rnd.Intn(len(accounts)), rnd.Intn(len(accounts))
+			t := NewTransaction(fmt.Sprintf("bench-%d-%d", start.Unix(), result.Submitted), accounts[from], accounts[to], benchAmount)
+			st := SignTransaction(t, cfg.Payers[from])
+
+			node := cfg.Nodes[result.Submitted%len(cfg.Nodes)]
+			result.Submitted++
+			if err := postJSON(client, node, "/submit", st, nil); err != nil {
+				result.Refused++
+				continue
+			}
+			pending[t.ID] = &benchPending{submitted: time.Now(), confirmed: map[int]bool{}}
+		}
+
+		for i, node := range cfg.Nodes {
+			ids := []string{}
+			for id, p := range pending {
+				if !p.confirmed[i] {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				continue
+			}
+
+			confirmed := []string{}
+			if err := postJSON(client, node, "/confirmed", ids, &confirmed); err != nil {
+				continue
+			}
+			for _, id := range confirmed {
+				p, found := pending[id]
+				if !found {
+					continue
+				}
+				p.confirmed[i] = true
+				if len(p.confirmed) == len(cfg.Nodes) {
+					result.Latencies = append(result.Latencies, time.Since(p.submitted))
+					result.Elapsed = time.Since(start)
+					delete(pending, id)
+				}
+			}
+		}
+
+		done = elapsed >= cfg.Load && (len(pending) == 0 || elapsed >= cfg.Load+cfg.Settle)
+	}
+
+	result.Confirmed = len(result.Latencies)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result
+}
+
+// postJSON sends v as JSON to the path of the explorer at address (host:port), decoding the answer in res if not nil
+func postJSON(client *http.Client, address, path string, v, res interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post("http://"+address+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// Throughput returns the transactions confirmed per second
+func (r BenchResult) Throughput() float64 {
+	if r.Elapsed == 0 {
+		return 0
+	}
+	return float64(r.Confirmed) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency under which p (0-100) percent of the confirmed transactions fall
+func (r BenchResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+
+	i := int(p/100*float64(len(r.Latencies))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+func (r BenchResult) String() string {
+	s := fmt.Sprintf("Submitted %d transactions to %d nodes in %v (%.1f/s)\n", r.Submitted, r.Nodes, r.Load, float64(r.Submitted)/r.Load.Seconds())
+	if r.Refused > 0 {
+		s += fmt.Sprintf("Refused %d\n", r.Refused)
+	}
+	if r.Submitted == 0 {
+		return s
+	}
+
+	s += fmt.Sprintf("Confirmed by all the nodes %d (%.1f%%), throughput %.1f transactions/s\n",
+		r.Confirmed, 100*float64(r.Confirmed)/float64(r.Submitted), r.Throughput())
+	s += fmt.Sprintf("Latency p50 %v p90 %v p99 %v max %v",
+		r.Percentile(50).Round(time.Millisecond), r.Percentile(90).Round(time.Millisecond),
+		r.Percentile(99).Round(time.Millisecond), r.Percentile(100).Round(time.Millisecond))
+	return s
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchConfirmsTransactions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 3, 6, nil, nil)
+	defer c.stop()
+
+	nodes := []string{}
+	for _, nd := range c.nodes {
+		server := httptest.NewServer(nd.explorerHandler())
+		defer server.Close()
+		nodes = append(nodes, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	r := Bench(BenchConfig{
+		Nodes:  nodes,
+		Rate:   20,
+		Load:   3 * time.Second,
+		Settle: 10 * time.Second,
+		Payers: c.signers})
+	t.Log("\n" + r.String())
+
+	if r.Submitted < 50 || r.Refused != 0 || r.Confirmed != r.Submitted {
+		t.Fatal("Not all the transactions were confirmed", r.Confirmed, "of", r.Submitted)
+	}
+	if r.Percentile(50) <= 0 || r.Percentile(50) > r.Percentile(100) || r.Throughput() <= 0 {
+		t.Error("Wrong statistics", r.Percentile(50), r.Percentile(100), r.Throughput())
+	}
+}
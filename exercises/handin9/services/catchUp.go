@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+
+	bt "../blocktree"
+)
+
+// A node whose parent or transactions are unknown (the peer was partitioned, restarted or just
+// slower than the others) is parked while they are fetched from the peers, the parent can
+// itself be parked so the missing part of the chain is walked back until a known node.
+// The parent may also be a node we received but that lost its slot here, it is then in the inventory.
+
+// maxParked is the maximum number of nodes waiting for their parent or transactions
+const maxParked = 1000
+
+// parking holds the nodes that can't be considered yet, it is used only by ProcessNodes
+type parking struct {
+	nodes []bt.SignedNode
+}
+
+// park adds the node, dropping the oldest one if full
+func (p *parking) park(sn bt.SignedNode) {
+	for _, parked := range p.nodes {
+		if bt.HashNode(&parked.Node) == bt.HashNode(&sn.Node) {
+			return
+		}
+	}
+
+	if len(p.nodes) >= maxParked {
+		p.nodes = p.nodes[1:]
+	}
+	p.nodes = append(p.nodes, sn)
+}
+
+// ready removes and returns the nodes that can now be considered (or are already in the tree)
+func (p *parking) ready(tree *bt.Tree) []bt.SignedNode {
+	ready := []bt.SignedNode{}
+	waiting := p.nodes[:0]
+
+	for _, sn := range p.nodes {
+		n := &sn.Node
+		if tree.HasNode(n) || isComplete(tree, n) {
+			ready = append(ready, sn)
+		} else {
+			waiting = append(waiting, sn)
+		}
+	}
+
+	p.nodes = waiting
+	return ready
+}
+
+// isComplete returns true if the parent and all the transactions of the node are known
+func isComplete(tree *bt.Tree, n *bt.Node) bool {
+	return tree.CheckIsNext(n) && len(tree.MissingTransactions(n)) == 0
+}
+
+// knownParent returns the parent of the node if received but not in the tree
+func (nd *Node) knownParent(n *bt.Node) (bt.SignedNode, bool) {
+	if nd.Tree.CheckIsNext(n) {
+		return bt.SignedNode{}, false
+	}
+
+	env, found := nd.inv.get(parentItem(n))
+	if !found || env.Node == nil {
+		return bt.SignedNode{}, false
+	}
+	return *env.Node, true
+}
+
+func parentItem(n *bt.Node) InvItem {
+	return InvItem{Type: NodeMsg, Hash: fmt.Sprintf("%x", n.Parent)}
+}
+
+// requestMissing asks the peers for the parent and the transactions of the node we don't know
+func (nd *Node) requestMissing(n *bt.Node) {
+	wanted := []InvItem{}
+
+	if !nd.Tree.CheckIsNext(n) && nd.inv.shouldRequest(parentItem(n), "") {
+		wanted = append(wanted, parentItem(n))
+	}
+
+	for _, id := range nd.Tree.MissingTransactions(n) {
+		if item := (InvItem{Type: TransactionMsg, ID: id}); nd.inv.shouldRequest(item, "") {
+			wanted = append(wanted, item)
+		}
+	}
+
+	if len(wanted) > maxInvItems {
+		wanted = wanted[:maxInvItems]
+	}
+	if len(wanted) > 0 {
+		nd.sendAll(Envelope{Type: GetDataMsg, Inventory: wanted})
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"time"
+
+	. "../peers"
+)
+
+// targetOutDegree is the number of peers after us in the list we keep a connection to
+const targetOutDegree = 10
+
+// maintenanceInterval is how often lost connections are redialed
+const maintenanceInterval = 5 * time.Second
+
+// backoff of the redials, after maxFailures attempts the peer is forgotten
+const (
+	baseBackoff = 2 * time.Second
+	maxBackoff  = 2 * time.Minute
+	maxFailures = 6
+)
+
+// redial keeps track of the failed attempts to connect to a peer
+type redial struct {
+	failures int
+	next     time.Time
+}
+
+// MaintainConnections keeps targetOutDegree connections open, redialing lost neighbours
+// and replacing dead ones with other known peers
+func (nd *Node) MaintainConnections() {
+	defer nd.Wg.Done()
+
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			nd.fillConnections()
+		case <-nd.quitCh:
+			return //Done
+		}
+	}
+}
+
+// fillConnections dials the peers after us in the list (with wrap around) until the out-degree is reached
+func (nd *Node) fillConnections() {
+	outDegree := 0
+	candidates := []*Peer{}
+
+	// collect first, the list is locked while iterating
+	neighbours := []*Peer{}
+	for p := range nd.PeerList.IterWrap(nd.LocalPeer()) {
+		neighbours = append(neighbours, p)
+	}
+
+	for _, p := range neighbours {
+		switch {
+		case p.GetAddress() == nd.LocalPeer().GetAddress():
+		case nd.isBanned(p.IP, nd.PeerList.GetKey(p.GetAddress())): // the key is set under the lock
+		case p.Connected():
+			if p.IsOutbound() {
+				outDegree++
+			}
+		case nd.canRedial(p):
+			candidates = append(candidates, p)
+		}
+	}
+
+	for _, p := range candidates {
+		if outDegree >= targetOutDegree {
+			break
+		}
+
+		if nd.dialNeighbour(p) {
+			outDegree++
+		}
+	}
+}
+
+// dialNeighbour dials a peer and serves the connection, returns true if it is a new outbound connection
+func (nd *Node) dialNeighbour(p *Peer) bool {
+	err := nd.dialPeer(p)
+	if err == errAlreadyConnected {
+		// reachable, it connected to us meanwhile
+		nd.dialSucceeded(p)
+		return false
+	}
+	if err != nil {
+		nd.Log.Info("Could not connect", peerAttr(p), "err", err)
+		nd.dialFailed(p)
+		return false
+	}
+
+	nd.dialSucceeded(p)
+	nd.Wg.Add(1)
+	go nd.handleConn(p)
+	return true
+}
+
+// canRedial returns true if the backoff of the peer expired
+func (nd *Node) canRedial(p *Peer) bool {
+	nd.redialsLock.Lock()
+	defer nd.redialsLock.Unlock()
+
+	r, found := nd.redials[p.GetAddress()]
+	return !found || time.Now().After(r.next)
+}
+
+// dialFailed doubles the backoff of the peer and forgets it after too many failures
+func (nd *Node) dialFailed(p *Peer) {
+	nd.redialsLock.Lock()
+	defer nd.redialsLock.Unlock()
+
+	r, found := nd.redials[p.GetAddress()]
+	if !found {
+		r = &redial{}
+		nd.redials[p.GetAddress()] = r
+	}
+	r.failures++
+
+	if r.failures >= maxFailures {
+		nd.Log.Info("Forgetting an unreachable peer", peerAttr(p), "failures", r.failures)
+		delete(nd.redials, p.GetAddress())
+		nd.PeerList.Remove(p)
+		return
+	}
+
+	wait := baseBackoff << uint(r.failures-1)
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	r.next = time.Now().Add(wait)
+}
+
+// dialSucceeded resets the backoff of the peer
+func (nd *Node) dialSucceeded(p *Peer) {
+	nd.redialsLock.Lock()
+	defer nd.redialsLock.Unlock()
+
+	delete(nd.redials, p.GetAddress())
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "../account"
+	. "../peers"
+	"../transport"
+)
+
+func TestRedialBackoff(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	p := &Peer{IP: "10.0.0.2", Port: 4444}
+	a.PeerList.SortedInsert(p)
+
+	if !a.canRedial(p) {
+		t.Fatal("Peer never dialed not redialable")
+	}
+	a.dialFailed(p)
+	if a.canRedial(p) {
+		t.Error("Peer redialable during its backoff")
+	}
+	if wait := time.Until(a.redials[p.GetAddress()].next); wait > baseBackoff || wait < baseBackoff/2 {
+		t.Error("Wrong first backoff", wait)
+	}
+
+	a.dialFailed(p)
+	if wait := time.Until(a.redials[p.GetAddress()].next); wait <= baseBackoff {
+		t.Error("Backoff not doubled", wait)
+	}
+
+	a.dialSucceeded(p)
+	if !a.canRedial(p) {
+		t.Error("Backoff not reset by a successful dial")
+	}
+
+	for i := 0; i < maxFailures; i++ {
+		a.dialFailed(p)
+	}
+	if a.PeerList.GetPeer(p.GetAddress()) != nil {
+		t.Error("Unreachable peer not forgotten")
+	}
+}
+
+func TestDialingAConnectedPeer(t *testing.T) {
+	mem := transport.NewMem(1)
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+
+	a := newTestNode(t, mem, "10.0.0.1", genesis)
+	a.Listen("10.0.0.1:4444")
+	a.CreateNetwork("10.0.0.1:")
+	a.Start()
+	defer a.Stop()
+
+	b := newTestNode(t, mem, "10.0.0.2", genesis)
+	b.Listen("10.0.0.2:5555")
+	b.ConnectToNetwork(Peer{IP: "10.0.0.1", Port: 4444}, "10.0.0.2:")
+	b.Start()
+	defer b.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var p *Peer
+	for p = a.PeerList.GetPeer("10.0.0.2:5555"); p == nil || !p.Connected(); p = a.PeerList.GetPeer("10.0.0.2:5555") {
+		if time.Now().After(deadline) {
+			t.Fatal("Nodes did not connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// b connected to us while we were dialing it, after failing other dials
+	for i := 0; i < maxFailures-1; i++ {
+		a.dialFailed(p)
+	}
+	if a.dialNeighbour(p) {
+		t.Error("Connected peer counted as a new outbound connection")
+	}
+	if a.PeerList.GetPeer(p.GetAddress()) != p || !p.Connected() || p.IsOutbound() {
+		t.Fatal("Connected peer dropped or its connection replaced by the dial")
+	}
+	if !a.canRedial(p) {
+		t.Error("Dial of a connected peer counted as a failure")
+	}
+}
+
+func TestOutDegreeMaintained(t *testing.T) {
+	mem := transport.NewMem(1)
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+
+	nodes := []*Node{}
+	known := []Peer{}
+	for i := 0; i < targetOutDegree+3; i++ {
+		host := fmt.Sprintf("10.0.1.%d", i+1)
+		nd := newTestNode(t, mem, host, genesis)
+		nd.Listen(host + ":4444")
+		if i == 0 {
+			nd.CreateNetwork(host + ":")
+		} else {
+			nd.ConnectToNetwork(Peer{IP: "10.0.1.1", Port: 4444}, host+":")
+		}
+		nd.Start()
+		defer nd.Stop()
+
+		nodes = append(nodes, nd)
+		known = append(known, Peer{IP: host, Port: 4444, LastSeen: time.Now()})
+	}
+
+	// outbound connections, false if some peer is not connected
+	outDegree := func(nd *Node) (int, bool) {
+		out, all := 0, true
+		for _, k := range known {
+			p := nd.PeerList.GetPeer(k.GetAddress())
+			switch {
+			case k.GetAddress() == nd.LocalPeer().GetAddress():
+			case p == nil || !p.Connected():
+				all = false
+			case p.IsOutbound():
+				out++
+			}
+		}
+		return out, all
+	}
+	// the target is reached unless every peer is already connected
+	waitOutDegree := func(nd *Node, timeout time.Duration) {
+		deadline := time.Now().Add(timeout)
+		for out, all := outDegree(nd); out != targetOutDegree && !all; out, all = outDegree(nd) {
+			if time.Now().After(deadline) {
+				t.Fatal("Out-degree not reached", nd.LocalPeer().GetAddress(), out)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if out, _ := outDegree(nd); out > targetOutDegree {
+			t.Error("Out-degree above the target", nd.LocalPeer().GetAddress(), out)
+		}
+	}
+
+	// everybody knows everybody, as after the peer exchange
+	for _, nd := range nodes {
+		nd.mergePeers(known)
+		nd.fillConnections()
+	}
+	for _, nd := range nodes {
+		waitOutDegree(nd, time.Second)
+	}
+
+	// a lost neighbour is replaced by the maintenance
+	nd := nodes[len(nodes)-1]
+	var lost *Peer
+	for _, k := range known {
+		if p := nd.PeerList.GetPeer(k.GetAddress()); p != nil && p.IsOutbound() && p.Connected() {
+			lost = p
+			break
+		}
+	}
+	if lost == nil {
+		t.Fatal("No outbound connection")
+	}
+	lost.Close()
+	for lost.Connected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitOutDegree(nd, 2*maintenanceInterval)
+}
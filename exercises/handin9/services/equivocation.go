@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	bt "../blocktree"
+)
+
+// evidenceWindow is the number of slots an offence is remembered, to be included in a node
+const evidenceWindow = 100
+
+// equivocations detects the peers signing two different nodes for a slot and keeps the
+// evidence until it is included in the chain, it is used only by ProcessNodes
+type equivocations struct {
+	signed   map[string]bt.SignedNode // first node seen by offence key
+	evidence map[string]bt.Evidence
+}
+
+func newEquivocations() *equivocations {
+	return &equivocations{
+		signed:   make(map[string]bt.SignedNode),
+		evidence: make(map[string]bt.Evidence)}
+}
+
+// offence identifies the nodes of a signer for a slot
+func offence(slot uint64, peer string) string {
+	return fmt.Sprint(slot, " ", peer)
+}
+
+// check returns the evidence if the node conflicts with another one of its signer for the slot
+func (e *equivocations) check(sn bt.SignedNode) (bt.Evidence, bool) {
+	key := offence(sn.Slot, sn.Peer)
+
+	first, found := e.signed[key]
+	if !found {
+		e.signed[key] = sn
+		return bt.Evidence{}, false
+	}
+
+	if _, known := e.evidence[key]; known || bt.HashNode(&first.Node) == bt.HashNode(&sn.Node) {
+		return bt.Evidence{}, false
+	}
+
+	ev := bt.NewEvidence(first, sn)
+	e.evidence[key] = ev
+	return ev, true
+}
+
+// add keeps the evidence received from a peer, returns false if the offence was known
+func (e *equivocations) add(ev bt.Evidence) bool {
+	key := offence(ev.Slot(), ev.First.Peer)
+
+	if _, known := e.evidence[key]; known {
+		return false
+	}
+	e.evidence[key] = ev
+	return true
+}
+
+// pending returns the evidence not punished yet by the chain of the head
+func (e *equivocations) pending(tree *bt.Tree) []bt.Evidence {
+	keys := []string{}
+	for key := range e.evidence {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := []bt.Evidence{}
+	for _, key := range keys {
+		list = append(list, e.evidence[key])
+	}
+
+	return tree.NewEvidence(tree.GetHead(), list)
+}
+
+// prune forgets the offences older than evidenceWindow
+func (e *equivocations) prune(slot uint64) {
+	for key, sn := range e.signed {
+		if sn.Slot+evidenceWindow < slot {
+			delete(e.signed, key)
+		}
+	}
+	for key, ev := range e.evidence {
+		if ev.Slot()+evidenceWindow < slot {
+			delete(e.evidence, key)
+		}
+	}
+}
+
+func (nd *Node) broadcastEvidence(ev bt.Evidence) {
+	nd.announce(evidenceItem(&ev), Envelope{Type: EvidenceMsg, Evidence: &ev})
+}
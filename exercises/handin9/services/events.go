@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	bt "../blocktree"
+	"../transport"
+)
+
+// The applications follow the chain on a local unix socket: they send a Subscription as a line
+// of JSON, then receive the events of the tree (see blocktree/events.go) as a line of JSON each.
+
+// eventQueueSize is how many events a subscriber may lag behind before being disconnected
+const eventQueueSize = 1024
+
+// subscriptionTimeout is how long a subscriber has to send its Subscription
+const subscriptionTimeout = 5 * time.Second
+
+// Subscription is the first line sent by a subscriber, the balance events are only
+// streamed for the accounts in Watch
+type Subscription struct {
+	Watch []string
+}
+
+type eventSubscriber struct {
+	watch  map[string]bool
+	events chan bt.Event
+}
+
+// eventStreams keeps the subscribers of the events of the tree
+type eventStreams struct {
+	subscribers map[*eventSubscriber]bool
+	lock        sync.Mutex
+}
+
+func newEventStreams() *eventStreams {
+	return &eventStreams{subscribers: make(map[*eventSubscriber]bool)}
+}
+
+func (es *eventStreams) add(sub Subscription) *eventSubscriber {
+	s := &eventSubscriber{
+		watch:  make(map[string]bool),
+		events: make(chan bt.Event, eventQueueSize)}
+	for _, account := range sub.Watch {
+		s.watch[account] = true
+	}
+
+	es.lock.Lock()
+	defer es.lock.Unlock()
+
+	es.subscribers[s] = true
+	return s
+}
+
+func (es *eventStreams) count() int {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+
+	return len(es.subscribers)
+}
+
+// remove forgets the subscriber and closes its queue, only once
+func (es *eventStreams) remove(s *eventSubscriber) {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+
+	if es.subscribers[s] {
+		delete(es.subscribers, s)
+		close(s.events)
+	}
+}
+
+// publish queues the events for the subscribers, it is called by the tree so it does not block:
+// the subscribers which are too slow are disconnected
+func (es *eventStreams) publish(events []bt.Event) {
+	es.lock.Lock()
+	defer es.lock.Unlock()
+
+	for s := range es.subscribers {
+		for _, ev := range events {
+			if ev.Type == bt.BalanceEvent && !s.watch[ev.Account] {
+				continue
+			}
+			select {
+			case s.events <- ev:
+				continue
+			default:
+			}
+			delete(es.subscribers, s)
+			close(s.events)
+			break
+		}
+	}
+}
+
+// ServeEvents streams the events of the tree on the unix socket until the node quits
+func (nd *Node) ServeEvents(socket string) {
+	os.Remove(socket)
+
+	// only the owner can follow the node
+	ln, err := transport.ListenUnix(socket)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	nd.Tree.Subscribe(nd.events.publish)
+	nd.Log.Info("Streaming the events", "socket", socket)
+
+	nd.Wg.Add(2)
+	go func() {
+		defer nd.Wg.Done()
+		<-nd.quitCh
+		ln.Close()
+	}()
+	go func() {
+		defer nd.Wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return //Done
+			}
+			nd.Wg.Add(1)
+			go nd.streamEvents(conn)
+		}
+	}()
+}
+
+// streamEvents reads the Subscription of the connection and sends it the events
+func (nd *Node) streamEvents(conn net.Conn) {
+	defer nd.Wg.Done()
+	defer conn.Close()
+
+	var sub Subscription
+	conn.SetReadDeadline(time.Now().Add(subscriptionTimeout))
+	if err := json.NewDecoder(conn).Decode(&sub); err != nil {
+		nd.Log.Info("Rejected subscriber", "err", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	s := nd.events.add(sub)
+	defer nd.events.remove(s)
+	nd.Log.Info("New subscriber", "watch", sub.Watch)
+
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				nd.Log.Warn("Disconnected a slow subscriber")
+				return //Done
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := enc.Encode(ev); err != nil {
+				nd.Log.Info("Subscriber left", "err", err)
+				return
+			}
+		case <-nd.quitCh:
+			return //Done
+		}
+	}
+}
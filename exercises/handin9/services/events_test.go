@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+	"../transport"
+)
+
+func TestEventsStreamedOnTheSocket(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	nd := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+	defer nd.Stop()
+
+	socket := filepath.Join(t.TempDir(), "events.sock")
+	nd.ServeEvents(socket)
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	json.NewEncoder(conn).Encode(Subscription{Watch: []string{"bob"}})
+
+	for deadline := time.Now().Add(time.Second); nd.events.count() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Subscription not received")
+		}
+	}
+
+	nd.Tree.ConsiderTransaction(NewTransaction("pay", "founder", "bob", 100), []string{})
+	n := bt.NewNode(42, 1, []string{"pay"}, nd.signer, nd.Tree.GetHead())
+	nd.Tree.ConsiderLeaf(n)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(conn)
+	var events []bt.Event
+	for len(events) == 0 || events[len(events)-1].Type != bt.HeadEvent {
+		if !lines.Scan() {
+			t.Fatal("Stream closed", lines.Err(), events)
+		}
+		var ev bt.Event
+		if err := json.Unmarshal(lines.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+
+	if len(events) != 3 || events[0].Type != bt.TransactionEvent || events[0].Transaction.ID != "pay" {
+		t.Fatal("Wrong events", events)
+	}
+	if events[1].Type != bt.BalanceEvent || events[1].Account != "bob" || events[1].Balance != 99 {
+		t.Error("Wrong balance event, only the watched accounts are expected", events[1])
+	}
+	if events[2].Slot != 1 {
+		t.Error("Wrong head", events[2])
+	}
+}
+
+func TestSlowSubscribersAreDropped(t *testing.T) {
+	es := newEventStreams()
+	s := es.add(Subscription{})
+
+	for i := 0; i <= eventQueueSize; i++ {
+		es.publish([]bt.Event{{Type: bt.HeadEvent, Slot: uint64(i)}})
+	}
+	if es.count() != 0 {
+		t.Fatal("Slow subscriber kept")
+	}
+
+	received := 0
+	for range s.events {
+		received++
+	}
+	if received != eventQueueSize {
+		t.Error("Wrong number of events queued", received)
+	}
+	es.remove(s)
+}
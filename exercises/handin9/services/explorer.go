@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+)
+
+// explorerSlots is how many of the last slots of the tree the explorer shows by default
+const explorerSlots = 60
+
+// maxRequestSize is the largest body POSTed to the explorer
+const maxRequestSize = 1 << 20
+
+// explorerState is polled by the page of the explorer, see explorerPage.go
+type explorerState struct {
+	bt.Snapshot
+	Account string // of the local machine
+	Peers   []peerState
+}
+
+type peerState struct {
+	Address   string
+	Account   string
+	Connected bool
+	Outbound  bool
+	Score     int
+	LastSeen  time.Time
+}
+
+// ServeExplorer serves the block explorer on address (host:port), the receipts at /receipts
+// and the submission and confirmation of transactions used by Bench at /submit and /confirmed
+func (nd *Node) ServeExplorer(address string) {
+	nd.serveHTTP(address, "Serving the block explorer", "/", nd.explorerHandler())
+}
+
+func (nd *Node) explorerHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", nd.handleExplorerPage)
+	mux.HandleFunc("/state", nd.handleExplorerState)
+	mux.HandleFunc("/receipts", nd.handleReceipts)
+	mux.HandleFunc("/submit", nd.handleSubmit)
+	mux.HandleFunc("/confirmed", nd.handleConfirmed)
+	return mux
+}
+
+// serveHTTP serves the local web pages until the node quits, msg is logged with the URL of path
+func (nd *Node) serveHTTP(address, msg, path string, handler http.Handler) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		panic(err.Error())
+	}
+	server := &http.Server{Handler: handler}
+
+	nd.Log.Info(msg, "url", "http://"+listener.Addr().String()+path)
+
+	nd.Wg.Add(2)
+	go func() {
+		defer nd.Wg.Done()
+		server.Serve(listener)
+	}()
+	go func() {
+		defer nd.Wg.Done()
+		<-nd.quitCh
+		server.Close()
+	}()
+}
+
+func (nd *Node) handleExplorerPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(explorerPage))
+}
+
+// handleExplorerState sends the state as JSON, the query parameter slots overrides explorerSlots
+func (nd *Node) handleExplorerState(w http.ResponseWriter, r *http.Request) {
+	slots := uint64(explorerSlots)
+	if s, err := strconv.ParseUint(r.URL.Query().Get("slots"), 10, 64); err == nil {
+		slots = s
+	}
+
+	since := uint64(0)
+	if current := nd.Tree.GetCurrentSlot(); current > slots {
+		since = current - slots
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nd.explorerState(since))
+}
+
+func (nd *Node) explorerState(since uint64) explorerState {
+	state := explorerState{
+		Snapshot: nd.Tree.Snapshot(since),
+		Account:  nd.ownAccount(),
+		Peers:    []peerState{}}
+
+	for _, p := range nd.PeerList.Snapshot() {
+		if p.PubKey == nd.LocalPeer().PubKey {
+			continue
+		}
+
+		ps := peerState{
+			Address:   p.GetAddress(),
+			Connected: p.Connected(),
+			Outbound:  p.IsOutbound(),
+			Score:     p.Score(),
+			LastSeen:  p.LastSeen}
+		if p.PubKey != "" {
+			ps.Account = AddressFromKey(p.PubKey)
+		}
+		state.Peers = append(state.Peers, ps)
+	}
+
+	return state
+}
+
+// handleSubmit takes a signed transaction POSTed as JSON, as if a peer sent it
+func (nd *Node) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a signed transaction", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var st SignedTransaction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&st); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !nd.verifyTransaction(st) {
+		http.Error(w, "invalid transaction", http.StatusBadRequest)
+		return
+	}
+	nd.Submit(st)
+}
+
+// handleConfirmed answers which of the transactions POSTed as a JSON list of IDs are in the chain of the head
+func (nd *Node) handleConfirmed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a list of transaction IDs", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ids []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	confirmed := []string{}
+	for _, id := range ids {
+		if nd.Tree.InChain(id) {
+			confirmed = append(confirmed, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(confirmed)
+}
@@ -0,0 +1,218 @@
+package services
+
+// explorerPage is the block explorer, it polls /state every second and draws the tree
+// with a column per slot and a row per branch, the chain to the head on the first row.
+// The content comes from the peers so it is only inserted as text.
+const explorerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Block explorer</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h2 { margin-top: 1.5em; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 10px; text-align: left; border-bottom: 1px solid #ddd; font-family: monospace; }
+th { font-family: sans-serif; }
+#tree { overflow-x: auto; border: 1px solid #ddd; }
+circle { cursor: pointer; stroke: #222; }
+.chain { fill: #4a4; }
+.fork { fill: #bbb; }
+.leaf { fill: #e90; }
+.selected { stroke-width: 3; }
+.burn { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Block explorer</h1>
+<p id="summary"></p>
+
+<h2>Tree</h2>
+<p>Green: chain to the head, orange: other leafs, grey: forks. Click a node for its transactions.</p>
+<div id="tree"></div>
+
+<h2>Node</h2>
+<div id="node">None selected</div>
+
+<h2>Balances</h2>
+<table id="balances"></table>
+
+<h2>Peers</h2>
+<table id="peers"></table>
+
+<script>
+"use strict";
+
+const svgNS = "http://www.w3.org/2000/svg";
+const step = 28;
+let selected = "";
+let state = null;
+
+function el(tag, text) {
+	const e = document.createElement(tag);
+	if (text !== undefined) {
+		e.textContent = text;
+	}
+	return e;
+}
+
+function svg(tag, attrs) {
+	const e = document.createElementNS(svgNS, tag);
+	for (const k in attrs) {
+		e.setAttribute(k, attrs[k]);
+	}
+	return e;
+}
+
+function short(s) {
+	return s ? s.slice(0, 10) : "";
+}
+
+function fillTable(table, header, rows) {
+	table.replaceChildren();
+	const tr = el("tr");
+	header.forEach(h => tr.appendChild(el("th", h)));
+	table.appendChild(tr);
+
+	rows.forEach(r => {
+		const tr = el("tr");
+		r.forEach(c => tr.appendChild(el("td", c)));
+		table.appendChild(tr);
+	});
+}
+
+// layout gives every node a column (its slot) and a row (its branch)
+function layout(nodes) {
+	const byHash = {}, children = {};
+	nodes.forEach(n => { byHash[n.Hash] = n; children[n.Hash] = []; });
+
+	const roots = [];
+	nodes.forEach(n => {
+		if (byHash[n.Parent]) {
+			children[n.Parent].push(n);
+		} else {
+			roots.push(n);
+		}
+	});
+
+	const slots = [...new Set(nodes.map(n => n.Slot))].sort((a, b) => a - b);
+	const column = {};
+	slots.forEach((s, i) => column[s] = i);
+
+	// the chain first, so that it stays on the first row
+	const first = (a, b) => (b.OnChain - a.OnChain) || (a.Slot - b.Slot);
+	roots.sort(first);
+
+	let rows = 0;
+	const pos = {};
+	function place(n, row) {
+		pos[n.Hash] = {x: column[n.Slot], y: row};
+		children[n.Hash].sort(first).forEach((c, i) => place(c, i == 0 ? row : ++rows));
+	}
+	roots.forEach((r, i) => place(r, i == 0 ? 0 : ++rows));
+
+	return {pos: pos, columns: slots.length, rows: rows + 1, slots: slots};
+}
+
+function drawTree() {
+	const l = layout(state.Nodes);
+	const root = svg("svg", {width: (l.columns + 1) * step, height: (l.rows + 1) * step + 12});
+	const x = p => p.x * step + step, y = p => p.y * step + step + 12;
+
+	l.slots.forEach((s, i) => {
+		if (i % 5 == 0) {
+			const t = svg("text", {x: i * step + step, y: 12, "font-size": 10, "text-anchor": "middle"});
+			t.textContent = s;
+			root.appendChild(t);
+		}
+	});
+
+	state.Nodes.forEach(n => {
+		const from = l.pos[n.Parent], to = l.pos[n.Hash];
+		if (from) {
+			root.appendChild(svg("path", {
+				d: "M" + x(from) + "," + y(from) + " L" + x(from) + "," + y(to) + " L" + x(to) + "," + y(to),
+				stroke: "#888", fill: "none"}));
+		}
+	});
+
+	state.Nodes.forEach(n => {
+		const p = l.pos[n.Hash];
+		const kind = n.OnChain ? "chain" : n.Leaf ? "leaf" : "fork";
+		const c = svg("circle", {cx: x(p), cy: y(p), r: 8, class: kind + (n.Hash == selected ? " selected" : "")});
+		const title = svg("title", {});
+		title.textContent = "slot " + n.Slot + "\n" + n.Hash + "\nby " + n.Account + "\n" + n.Transactions.length + " transactions";
+		c.appendChild(title);
+		c.addEventListener("click", () => { selected = n.Hash; render(); });
+		root.appendChild(c);
+	});
+
+	document.getElementById("tree").replaceChildren(root);
+}
+
+function drawNode() {
+	const div = document.getElementById("node");
+	const n = state.Nodes.find(n => n.Hash == selected);
+	if (!n) {
+		div.textContent = selected ? "No longer shown" : "None selected";
+		return;
+	}
+
+	div.replaceChildren();
+	const info = el("table");
+	fillTable(info, ["", ""], [
+		["Hash", n.Hash],
+		["Parent", n.Parent],
+		["Slot", String(n.Slot)],
+		["Created by", n.Account],
+		["Status", n.OnChain ? "on the chain" : n.Leaf ? "leaf of a fork" : "fork"]]);
+	div.appendChild(info);
+
+	n.Offenders.forEach(o => {
+		const p = el("p", "Burns the stake of " + o);
+		p.className = "burn";
+		div.appendChild(p);
+	});
+
+	div.appendChild(el("h3", n.Transactions.length + " transactions"));
+	const trans = el("table");
+	fillTable(trans, ["ID", "From", "To", "Amount"],
+		n.Transactions.map(t => [t.ID, t.From, t.To, t.From ? String(t.Amount) : "unknown"]));
+	div.appendChild(trans);
+}
+
+function render() {
+	const head = state.Nodes.find(n => n.Hash == state.Head);
+	document.getElementById("summary").textContent =
+		"Network " + short(state.Genesis) + " | current slot " + state.Slot +
+		" | head " + short(state.Head) + (head ? " at slot " + head.Slot : "") +
+		" | local account " + state.Account;
+
+	drawTree();
+	drawNode();
+
+	const accounts = Object.keys(state.Balances).sort((a, b) => state.Balances[b] - state.Balances[a] || a.localeCompare(b));
+	fillTable(document.getElementById("balances"), ["Account", "Balance"],
+		accounts.map(a => [a + (a == state.Account ? " (local)" : ""), String(state.Balances[a])]));
+
+	fillTable(document.getElementById("peers"), ["Address", "Account", "Connection", "Score", "Last seen"],
+		state.Peers.map(p => [p.Address, p.Account, p.Connected ? (p.Outbound ? "outbound" : "inbound") : "-",
+			String(p.Score), new Date(p.LastSeen).toLocaleTimeString()]));
+}
+
+async function refresh() {
+	try {
+		const r = await fetch("state");
+		state = await r.json();
+		render();
+	} catch (e) {
+		document.getElementById("summary").textContent = "Node not reachable: " + e;
+	}
+	setTimeout(refresh, 1000);
+}
+
+refresh();
+</script>
+</body>
+</html>
+`
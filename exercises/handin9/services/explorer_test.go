@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "../account"
+	"../transport"
+)
+
+func TestExplorerState(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	nd := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	w := httptest.NewRecorder()
+	nd.handleExplorerState(w, httptest.NewRequest("GET", "/state?slots=10", nil))
+
+	var state explorerState
+	if err := json.NewDecoder(w.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Nodes) != 1 || state.Head != state.Nodes[0].Hash || state.Balances["founder"] != 1e6 {
+		t.Error("Wrong state", state)
+	}
+	if state.Account != nd.ownAccount() {
+		t.Error("Wrong local account", state.Account)
+	}
+
+	w = httptest.NewRecorder()
+	nd.handleExplorerPage(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || w.Body.Len() == 0 {
+		t.Error("Page not served", w.Code)
+	}
+}
+
+func TestExplorerTransactionAPI(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	nd := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+	handler := nd.explorerHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/submit", strings.NewReader(`{"ID":"1","From":"founder","To":"someone","Amount":5}`)))
+	if w.Code != 400 {
+		t.Error("Unsigned transaction accepted", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/confirmed", nil))
+	if w.Code != 405 {
+		t.Error("Confirmations answered without IDs", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/confirmed", strings.NewReader(`["1","2"]`)))
+	var confirmed []string
+	if err := json.NewDecoder(w.Body).Decode(&confirmed); err != nil || len(confirmed) != 0 {
+		t.Error("Unknown transactions confirmed", confirmed, err)
+	}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"testing"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+	. "../peers"
+	"../transport"
+)
+
+// cluster runs founders' nodes over the in-memory transport, a schedule of faults is
+// injected while transactions are submitted, then the ledgers are expected to converge
+type cluster struct {
+	t       *testing.T
+	mem     *transport.Mem
+	rnd     *rand.Rand
+	signers []aesrsa.Signer // one founder per node, only the founders have stake
+	genesis []Transaction
+	nodes   []*Node // nil if crashed
+	modes   map[int]Adversary
+	clock   bt.Clock // of all the nodes, nil for the real one
+	sent    int
+}
+
+// fault is an event of the schedule, at is the time since the start of the run
+type fault struct {
+	at   time.Duration
+	name string
+	do   func(c *cluster)
+}
+
+// txInterval is how often a transaction is submitted during the run
+const txInterval = 100 * time.Millisecond
+
+// newCluster starts n nodes, the ones in modes misbehave
+func newCluster(t *testing.T, n int, seed int64, modes map[int]Adversary, clock bt.Clock) *cluster {
+	c := &cluster{
+		t:       t,
+		mem:     transport.NewMem(seed),
+		rnd:     rand.New(rand.NewSource(seed)),
+		genesis: []Transaction{},
+		nodes:   make([]*Node, n),
+		modes:   modes,
+		clock:   clock}
+
+	for i := 0; i < n; i++ {
+		signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.signers = append(c.signers, signer)
+
+		address := AddressFromKey(aesrsa.VerifierToString(signer.Verifier()))
+		c.genesis = append(c.genesis, NewTransaction(fmt.Sprintf("Genesis - %d", i), "Genesis", address, 1e6))
+	}
+
+	for i := range c.nodes {
+		c.start(i)
+	}
+	return c
+}
+
+func (c *cluster) host(i int) string {
+	return fmt.Sprintf("10.0.0.%d", i+1)
+}
+
+func (c *cluster) account(i int) string {
+	return AddressFromKey(aesrsa.VerifierToString(c.signers[i].Verifier()))
+}
+
+// start runs the node i with an empty tree, connecting it to the first running node
+func (c *cluster) start(i int) {
+	tree := bt.NewTree(c.genesis)
+	if c.clock != nil {
+		tree.Clock = c.clock
+	}
+
+	nd := NewNode(tree, c.signers[i], c.mem.Host(c.host(i)))
+	nd.Adversary = c.modes[i]
+	nd.Log = slog.Default().With("node", c.host(i))
+	nd.Listen(c.host(i) + ":4444")
+
+	first := -1
+	for j, other := range c.nodes {
+		if other != nil && j != i {
+			first = j
+			break
+		}
+	}
+
+	if first < 0 {
+		nd.CreateNetwork(c.host(i) + ":")
+	} else {
+		nd.ConnectToNetwork(Peer{IP: c.host(first), Port: 4444}, c.host(i)+":")
+	}
+	nd.Start()
+	c.nodes[i] = nd
+}
+
+func (c *cluster) crash(i int) {
+	c.nodes[i].Stop()
+	c.nodes[i] = nil
+}
+
+// partition splits the nodes in groups that can't reach each other
+func (c *cluster) partition(groups ...[]int) {
+	hosts := [][]string{}
+	for _, g := range groups {
+		hs := []string{}
+		for _, i := range g {
+			hs = append(hs, c.host(i))
+		}
+		hosts = append(hosts, hs)
+	}
+	c.mem.Partition(hosts...)
+}
+
+// submit sends a payment between two random founders through the node of the payer,
+// returns false if the payer is crashed
+func (c *cluster) submit() (SignedTransaction, bool) {
+	from := c.rnd.Intn(len(c.nodes))
+	to := c.rnd.Intn(len(c.nodes))
+	if c.nodes[from] == nil {
+		return SignedTransaction{}, false
+	}
+
+	c.sent++
+	t := NewTransaction(fmt.Sprintf("%d-harness", c.sent), c.account(from), c.account(to), uint64(2+c.rnd.Intn(100)))
+	st := SignTransaction(t, c.signers[from])
+	go c.nodes[from].Submit(st)
+	return st, true
+}
+
+// waitKnown waits until all the running nodes processed the transaction
+func (c *cluster) waitKnown(st SignedTransaction, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for _, nd := range c.nodes {
+		for nd != nil && !nd.inv.known(txItem(&st)) {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return true
+}
+
+// run submits transactions for the duration while injecting the faults on schedule
+func (c *cluster) run(duration time.Duration, schedule []fault) {
+	start := time.Now()
+	ticker := time.NewTicker(txInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for len(schedule) > 0 && now.Sub(start) >= schedule[0].at {
+			c.t.Log("Injecting", schedule[0].name)
+			schedule[0].do(c)
+			schedule = schedule[1:]
+		}
+
+		if now.Sub(start) >= duration {
+			return
+		}
+		c.submit()
+	}
+}
+
+// converged returns true if the running honest nodes have the same head and ledger
+func (c *cluster) converged() bool {
+	var head, ledger string
+
+	for _, nd := range c.nodes {
+		if nd == nil || nd.Adversary != Honest {
+			continue
+		}
+
+		h, l := fmt.Sprintf("%x", bt.HashNode(nd.Tree.GetHead())), nd.Tree.GetLedger()
+		if head == "" {
+			head, ledger = h, l
+		} else if h != head || l != ledger {
+			return false
+		}
+	}
+	return true
+}
+
+// waitConvergence submits a transaction per slot, so that forks of the same length get resolved,
+// until the ledgers are identical
+func (c *cluster) waitConvergence(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	lastTx := time.Time{}
+
+	for time.Now().Before(deadline) {
+		if c.converged() {
+			return true
+		}
+		if time.Since(lastTx) >= time.Second {
+			c.submit()
+			lastTx = time.Now()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// expectConvergence fails the test if the honest ledgers don't converge before the timeout
+func (c *cluster) expectConvergence(timeout time.Duration) {
+	if !c.waitConvergence(timeout) {
+		for i, nd := range c.nodes {
+			if nd != nil {
+				c.t.Logf("Node %d (%q) head %x\n%s", i, nd.Adversary, bt.HashNode(nd.Tree.GetHead()), nd.Tree.GetLedger())
+			}
+		}
+		c.t.Fatal("Ledgers did not converge")
+	}
+
+	for _, nd := range c.nodes {
+		if nd != nil && nd.Adversary == Honest && nd.Tree.GetHead().Slot == 0 {
+			c.t.Fatal("No node was added to the chain")
+		}
+	}
+}
+
+func (c *cluster) stop() {
+	for i, nd := range c.nodes {
+		if nd != nil {
+			c.crash(i)
+		}
+	}
+}
+
+func TestLedgersConvergeAfterFaults(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 5, 1, nil, nil)
+	defer c.stop()
+
+	c.run(20*time.Second, []fault{
+		{2 * time.Second, "delays", func(c *cluster) { c.mem.SetLatency(50*time.Millisecond, 100*time.Millisecond) }},
+		{3 * time.Second, "loss", func(c *cluster) { c.mem.SetLoss(0.05) }},
+		{4 * time.Second, "partition", func(c *cluster) { c.partition([]int{0, 1, 2}, []int{3, 4}) }},
+		{9 * time.Second, "heal", func(c *cluster) { c.mem.Heal() }},
+		{11 * time.Second, "crash", func(c *cluster) { c.crash(4) }},
+		{14 * time.Second, "restart", func(c *cluster) { c.start(4) }},
+	})
+
+	c.expectConvergence(30 * time.Second)
+}
+
+func TestHonestLedgersConvergeWithAdversaries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 7, 2, map[int]Adversary{3: Equivocate, 4: Withhold, 5: DoubleSpend, 6: LieSlot}, nil)
+	defer c.stop()
+
+	c.mem.SetLatency(20*time.Millisecond, 50*time.Millisecond)
+	c.run(10*time.Second, nil)
+	c.expectConvergence(30 * time.Second)
+}
+
+func TestInvalidTransactionsGetSenderBanned(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 3, 3, map[int]Adversary{2: InvalidTx}, nil)
+	defer c.stop()
+
+	deadline := time.Now().Add(15 * time.Second)
+	key := aesrsa.VerifierToString(c.signers[2].Verifier())
+	for !c.nodes[0].isBanned(c.host(2), "") || !c.nodes[0].isBanned("", key) {
+		if time.Now().After(deadline) {
+			t.Fatal("Adversary not banned")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestEquivocatorIsSlashed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 4, 4, map[int]Adversary{3: Equivocate}, nil)
+	defer c.stop()
+
+	c.run(8*time.Second, nil)
+	c.expectConvergence(30 * time.Second)
+
+	// the payments received after the burn are kept
+	if balance := c.nodes[0].Tree.GetBalance(c.account(3)); balance > 1e5 {
+		t.Error("The stake of the equivocator was not burned, balance", balance)
+	}
+}
+
+func TestHundredsOfSlotsWithSimulatedClock(t *testing.T) {
+	clock := bt.NewSimClock(time.Unix(1e9, 0))
+	c := newCluster(t, 3, 5, nil, clock)
+	defer c.stop()
+
+	tree := c.nodes[0].Tree
+	start := tree.GetCurrentSlot()
+
+	// a transaction per slot, so that every slot has nodes
+	const slots = 200
+	for s := 0; s < slots; s++ {
+		if st, _ := c.submit(); !c.waitKnown(st, 5*time.Second) {
+			t.Fatal("Transaction not received by all the nodes")
+		}
+		clock.Advance(tree.SlotLength)
+		time.Sleep(10 * time.Millisecond)
+	}
+	clock.Advance(tree.SlotLength)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.converged() {
+		if time.Now().After(deadline) {
+			t.Fatal("Ledgers did not converge")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if head := tree.GetHead().Slot; head < start+slots*9/10 {
+		t.Error("Only", head-start, "of", slots, "slots made it to the chain")
+	}
+}
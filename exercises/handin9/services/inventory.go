@@ -0,0 +1,260 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+	. "../peers"
+)
+
+// Transactions and nodes are not flooded: the hash is announced (InvMsg) and the peers
+// that don't know it ask for the body (GetDataMsg), so each body crosses each link at most once.
+
+// inventorySize is the number of recent bodies kept to be served to the peers
+const inventorySize = 10000
+
+// inventoryExpiry is the age after which a body not in the chain is evicted
+const inventoryExpiry = 10 * time.Minute
+
+// keptSize is the number of bodies of the chain kept for the late peers, the oldest are evicted first
+const keptSize = 100000
+
+// maxInvItems is the maximum number of items in an announce or request
+const maxInvItems = 1000
+
+// requestTimeout is the time before an item requested and not received can be asked to another peer
+const requestTimeout = 5 * time.Second
+
+// InvItem identifies a transaction or a node
+type InvItem struct {
+	Type MessageType // TransactionMsg, NodeMsg or EvidenceMsg
+	Hash string
+	// ID asks a transaction by its ID instead of the hash, as the nodes list them (see catchUp.go)
+	ID string `json:",omitempty"`
+}
+
+type invEntry struct {
+	item  InvItem
+	added time.Time
+}
+
+// request is an item asked to a peer ("" if asked to all)
+type request struct {
+	time time.Time
+	peer string
+}
+
+// inventory is the seen-cache, it keeps the bodies of the recent valid messages
+// and the ones of the chain, to let the late peers catch up
+type inventory struct {
+	bodies    map[InvItem]Envelope
+	order     []invEntry // evicted first to last, by size or age
+	ids       map[string]InvItem
+	kept      map[InvItem]bool
+	keptOrder []InvItem // the kept bodies, evicted first to last past keptSize
+	requested map[InvItem]request
+	lock      sync.Mutex
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		bodies:    make(map[InvItem]Envelope),
+		order:     make([]invEntry, 0),
+		ids:       make(map[string]InvItem),
+		kept:      make(map[InvItem]bool),
+		keptOrder: make([]InvItem, 0),
+		requested: make(map[InvItem]request)}
+}
+
+// add stores the body of the item, returns false if it was already known
+func (i *inventory) add(item InvItem, env Envelope) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, found := i.bodies[item]; found {
+		return false
+	}
+
+	now := time.Now()
+	for len(i.order) > 0 && (len(i.order) >= inventorySize || now.Sub(i.order[0].added) > inventoryExpiry) {
+		if old := i.order[0].item; !i.kept[old] {
+			i.remove(old)
+		}
+		i.order = i.order[1:]
+	}
+
+	i.bodies[item] = env
+	delete(i.requested, item)
+
+	if env.Transaction != nil {
+		i.ids[env.Transaction.ID] = item
+	}
+	i.order = append(i.order, invEntry{item: item, added: now})
+	return true
+}
+
+// remove drops the body of the item, without locks as private
+func (i *inventory) remove(item InvItem) {
+	if st := i.bodies[item].Transaction; st != nil && i.ids[st.ID] == item {
+		delete(i.ids, st.ID)
+	}
+	delete(i.bodies, item)
+}
+
+// keep prevents the node and its transactions from being evicted, as part of the chain
+func (i *inventory) keep(n *bt.Node) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.protect(InvItem{Type: NodeMsg, Hash: fmt.Sprintf("%x", bt.HashNode(n))})
+	for _, id := range n.TransList {
+		if item, found := i.ids[id]; found {
+			i.protect(item)
+		}
+	}
+}
+
+// protect marks a known item as kept and evicts the oldest kept past keptSize, without locks as private
+func (i *inventory) protect(item InvItem) {
+	if _, found := i.bodies[item]; !found || i.kept[item] {
+		return
+	}
+
+	i.kept[item] = true
+	i.keptOrder = append(i.keptOrder, item)
+
+	if len(i.keptOrder) > keptSize {
+		old := i.keptOrder[0]
+		delete(i.kept, old)
+		i.remove(old)
+		i.keptOrder = i.keptOrder[1:]
+	}
+}
+
+func (i *inventory) get(item InvItem) (Envelope, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.lookup(item)
+}
+
+// lookup finds the body of the item by hash or ID, without locks as private
+func (i *inventory) lookup(item InvItem) (Envelope, bool) {
+	if item.ID != "" {
+		if byID, found := i.ids[item.ID]; found {
+			item = byID
+		}
+	}
+
+	env, found := i.bodies[item]
+	return env, found
+}
+
+func (i *inventory) known(item InvItem) bool {
+	_, found := i.get(item)
+	return found
+}
+
+// shouldRequest returns true (and marks the item as requested from the peer) if the item
+// is unknown and not already requested from another peer
+func (i *inventory) shouldRequest(item InvItem, peer string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, found := i.lookup(item); found {
+		return false
+	}
+
+	now := time.Now()
+	if r, found := i.requested[item]; found && now.Sub(r.time) < requestTimeout {
+		return false
+	}
+
+	if len(i.requested) >= inventorySize {
+		for it, r := range i.requested {
+			if now.Sub(r.time) >= requestTimeout {
+				delete(i.requested, it)
+			}
+		}
+	}
+
+	i.requested[item] = request{time: now, peer: peer}
+	return true
+}
+
+// forgetRequests drops the items requested from a disconnected peer, they can be asked to the others
+func (i *inventory) forgetRequests(peer string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for item, r := range i.requested {
+		if r.peer == peer {
+			delete(i.requested, item)
+		}
+	}
+}
+
+func txItem(st *SignedTransaction) InvItem {
+	jsonSt, err := json.Marshal(st)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return InvItem{Type: TransactionMsg, Hash: fmt.Sprintf("%x", sha256.Sum256(jsonSt))}
+}
+
+func nodeItem(sn *bt.SignedNode) InvItem {
+	return InvItem{Type: NodeMsg, Hash: fmt.Sprintf("%x", bt.HashNode(&sn.Node))}
+}
+
+func evidenceItem(ev *bt.Evidence) InvItem {
+	jsonEv, err := json.Marshal(ev)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return InvItem{Type: EvidenceMsg, Hash: fmt.Sprintf("%x", sha256.Sum256(jsonEv))}
+}
+
+// announce stores a valid message and announces it to the neighbours if it is new
+func (nd *Node) announce(item InvItem, env Envelope) {
+	if nd.inv.add(item, env) && !nd.withholds(item) {
+		nd.sendAll(Envelope{Type: InvMsg, Inventory: []InvItem{item}})
+	}
+}
+
+// handleInv asks the peer for the announced items we don't know
+func (nd *Node) handleInv(p *Peer, items []InvItem) {
+	if len(items) > maxInvItems {
+		items = items[:maxInvItems]
+	}
+
+	wanted := []InvItem{}
+	for _, item := range items {
+		if (item.Type == TransactionMsg || item.Type == NodeMsg || item.Type == EvidenceMsg) && nd.inv.shouldRequest(item, p.GetAddress()) {
+			wanted = append(wanted, item)
+		}
+	}
+
+	if len(wanted) > 0 {
+		nd.send(p, Envelope{Type: GetDataMsg, Inventory: wanted})
+	}
+}
+
+// handleGetData sends to the peer the requested items we know
+func (nd *Node) handleGetData(p *Peer, items []InvItem) {
+	if len(items) > maxInvItems {
+		items = items[:maxInvItems]
+	}
+
+	for _, item := range items {
+		if env, found := nd.inv.get(item); found && !nd.withholds(item) {
+			nd.send(p, env)
+		}
+	}
+}
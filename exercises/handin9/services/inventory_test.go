@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+)
+
+func TestInventoryEviction(t *testing.T) {
+	i := newInventory()
+
+	for n := 0; n <= inventorySize; n++ {
+		item := InvItem{Type: TransactionMsg, Hash: strconv.Itoa(n)}
+		if !i.add(item, Envelope{Type: TransactionMsg}) {
+			t.Fatal("New item reported as known")
+		}
+	}
+
+	if i.known(InvItem{Type: TransactionMsg, Hash: "0"}) {
+		t.Error("Oldest item not evicted")
+	}
+	if !i.known(InvItem{Type: TransactionMsg, Hash: strconv.Itoa(inventorySize)}) {
+		t.Error("Newest item evicted")
+	}
+	if i.add(InvItem{Type: TransactionMsg, Hash: "1"}, Envelope{}) {
+		t.Error("Known item added twice")
+	}
+}
+
+func TestShouldRequestOnce(t *testing.T) {
+	i := newInventory()
+	item := InvItem{Type: NodeMsg, Hash: "abc"}
+
+	if !i.shouldRequest(item, "peer") {
+		t.Fatal("Unknown item not requested")
+	}
+	if i.shouldRequest(item, "other") {
+		t.Error("Item requested twice before the timeout")
+	}
+
+	i.add(item, Envelope{Type: NodeMsg})
+	if i.shouldRequest(item, "other") {
+		t.Error("Known item requested")
+	}
+}
+
+func TestRequestsForgottenOnDisconnect(t *testing.T) {
+	i := newInventory()
+	item := InvItem{Type: NodeMsg, Hash: "abc"}
+
+	i.shouldRequest(item, "peer")
+	i.forgetRequests("other")
+	if i.shouldRequest(item, "other") {
+		t.Error("Item requested twice before the timeout")
+	}
+
+	i.forgetRequests("peer")
+	if !i.shouldRequest(item, "other") {
+		t.Error("Item of a disconnected peer not requested again")
+	}
+}
+
+func TestInventoryExpiry(t *testing.T) {
+	i := newInventory()
+
+	old := InvItem{Type: NodeMsg, Hash: "old"}
+	i.add(old, Envelope{Type: NodeMsg})
+	i.order[0].added = time.Now().Add(-inventoryExpiry - time.Second)
+	i.add(InvItem{Type: NodeMsg, Hash: "new"}, Envelope{Type: NodeMsg})
+
+	if i.known(old) {
+		t.Error("Expired node not evicted")
+	}
+	if len(i.order) != 1 {
+		t.Errorf("%d items in the order, expected 1", len(i.order))
+	}
+}
+
+func TestInventoryKeepsChain(t *testing.T) {
+	i := newInventory()
+
+	n := &bt.Node{Slot: 1, TransList: []string{"0-a"}}
+	node := InvItem{Type: NodeMsg, Hash: fmt.Sprintf("%x", bt.HashNode(n))}
+	i.add(node, Envelope{Type: NodeMsg})
+	fork := InvItem{Type: NodeMsg, Hash: "fork"}
+	i.add(fork, Envelope{Type: NodeMsg})
+	tx := InvItem{Type: TransactionMsg, Hash: "tx"}
+	i.add(tx, Envelope{Type: TransactionMsg, Transaction: &SignedTransaction{ID: "0-a"}})
+	i.keep(n)
+
+	for n := 0; n <= inventorySize; n++ {
+		i.add(InvItem{Type: TransactionMsg, Hash: strconv.Itoa(n)}, Envelope{Type: TransactionMsg})
+	}
+
+	if !i.known(node) {
+		t.Error("Node of the chain evicted")
+	}
+	if i.known(fork) {
+		t.Error("Node out of the chain not evicted")
+	}
+	if env, found := i.get(InvItem{Type: TransactionMsg, ID: "0-a"}); !found || env.Transaction.ID != "0-a" {
+		t.Error("Kept transaction not found by ID")
+	}
+}
@@ -8,47 +8,154 @@ import (
 
 	. "../account"
 	"../aesrsa"
+	"../agent"
 )
 
-var abbreviations map[string]string
-
 // Write handles the input from keyboard
-func Write(listenCh chan<- SignedTransaction, quitCh chan<- struct{}) {
-	defer Wg.Done()
+func (nd *Node) Write() {
+	defer nd.Wg.Done()
 
-	fmt.Println("Insert a transaction as: FromWho ToWho HowMuch each on different lines, then the private key to sign it ")
+	fmt.Println("Insert a transaction as: FromWho ToWho HowMuch each on different lines (input number or address), then the private key to sign it ")
+	fmt.Println("Insert \"multisig\" instead of an account to create a m-of-n account")
+	fmt.Println("Insert \"receipts\" instead of an account to see what happened to the transactions sent")
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Split(bufio.ScanLines)
 
-	abbreviations = map[string]string{}
-
 	for {
-		t, quit := askTransaction(scanner)
+		t, quit := nd.askTransaction(scanner)
 		if quit {
 			fmt.Println("quitting...")
-			close(quitCh)
+			nd.Quit()
 			break //Done
 		}
-		t = attachNextID(t)
-		fmt.Println("Confirm with Secret Key")
-		key := aesrsa.KeyFromString(scanPrivKey(scanner))
-		st := SignTransaction(t, key)
-		listenCh <- st
-		fmt.Println("Sent")
+		t = nd.attachNextID(t)
+
+		var st SignedTransaction
+		if m, found := nd.Tree.GetMultisig(t.From); found {
+			st, quit = nd.cosignTransaction(scanner, t, m)
+		} else {
+			st, quit = nd.signTransaction(scanner, t)
+		}
+
+		if quit {
+			continue
+		}
+
+		nd.Track(st)
+		nd.Submit(st)
+		fmt.Println("Sent transaction", st.ID)
+	}
+}
+
+// signTransaction asks for the secret key of the sender, returns true if it wasn't valid or the agent refused
+func (nd *Node) signTransaction(scanner *bufio.Scanner, t Transaction) (SignedTransaction, bool) {
+	if signer, found := nd.agentSigner(t.From); found {
+		st := SignTransaction(t, signer)
+		if err := agent.Refusal(signer); err != nil {
+			fmt.Println("The agent refused to sign:", err)
+			return SignedTransaction{}, true
+		}
+		fmt.Println("Signed by the agent")
+		return st, false
+	}
+
+	fmt.Println("Confirm with Secret Key")
+	signer, err := aesrsa.SignerFromString(scanPEMKey(scanner))
+	if err != nil {
+		fmt.Println("Invalid secret key:", err)
+		return SignedTransaction{}, true
+	}
+	return SignTransaction(t, signer), false
+}
+
+// cosignTransaction asks for secret keys until the threshold of the multisig account is reached, returns true if aborted
+// or the agent refused
+func (nd *Node) cosignTransaction(scanner *bufio.Scanner, t Transaction, m MultisigAccount) (SignedTransaction, bool) {
+	st := NewMultisigTransaction(t, m)
+
+	for _, k := range m.Keys {
+		if signer, found := nd.agentSigner(AddressFromKey(k)); found && st.CountSignatures() < m.Threshold {
+			if st.Cosign(signer) != nil {
+				continue
+			}
+			if err := agent.Refusal(signer); err != nil {
+				fmt.Println("The agent refused to cosign:", err)
+				return SignedTransaction{}, true
+			}
+			fmt.Println("Cosigned by the agent")
+		}
+	}
+
+	for st.CountSignatures() < m.Threshold {
+		fmt.Printf("Confirm with Secret Key (%d of %d signatures)\n", st.CountSignatures()+1, m.Threshold)
+		key := scanPEMKey(scanner)
+		if key == "quit" {
+			return SignedTransaction{}, true
+		}
+
+		signer, err := aesrsa.SignerFromString(key)
+		if err == nil {
+			err = st.Cosign(signer)
+		}
+		if err != nil {
+			fmt.Println("Invalid secret key:", err)
+		}
+	}
+
+	return st, false
+}
+
+// createMultisig asks threshold and public keys of a new m-of-n account and registers it
+func (nd *Node) createMultisig(scanner *bufio.Scanner) {
+	fmt.Println("Insert the threshold and the number of keys on different lines, then the public keys")
+
+	threshold, err1 := strconv.Atoi(scanLine(scanner))
+	n, err2 := strconv.Atoi(scanLine(scanner))
+	if err1 != nil || err2 != nil || n < 1 {
+		fmt.Println("not valid integer")
+		return
+	}
+
+	keys := []string{}
+	for i := 0; i < n; i++ {
+		keys = append(keys, scanPEMKey(scanner))
+	}
+
+	m, err := NewMultisigAccount(threshold, keys)
+	if err != nil {
+		fmt.Println("Invalid multisig account:", err)
+		return
 	}
+
+	fmt.Println("Multisig account", m, "created:", nd.Tree.RegisterMultisig(m))
+}
+
+// agentSigner returns the signer of the agent for the address if it holds the key
+func (nd *Node) agentSigner(address string) (aesrsa.Signer, bool) {
+	if nd.SigningAgent == nil {
+		return nil, false
+	}
+
+	signer, err := nd.SigningAgent.Signer(address)
+	return signer, err == nil
+}
+
+func scanLine(scanner *bufio.Scanner) string {
+	scanner.Scan()
+	return scanner.Text()
 }
 
-func askTransaction(scanner *bufio.Scanner) (Transaction, bool) {
+func (nd *Node) askTransaction(scanner *bufio.Scanner) (Transaction, bool) {
 
-	printKeys()
+	nd.printKeys()
 
-	from := scanKey(scanner)
+	from := nd.scanKey(scanner)
 
 	if from == "quit" {
 		return Transaction{}, true
 	}
 
-	to := scanKey(scanner)
+	to := nd.scanKey(scanner)
 
 	if to == "quit" {
 		return Transaction{}, true
@@ -83,7 +190,7 @@ func askTransaction(scanner *bufio.Scanner) (Transaction, bool) {
 		Amount: intAmount}, false
 }
 
-func scanKey(scanner *bufio.Scanner) string {
+func (nd *Node) scanKey(scanner *bufio.Scanner) string {
 	for {
 		scanner.Scan()
 		buf := scanner.Text()
@@ -92,59 +199,90 @@ func scanKey(scanner *bufio.Scanner) string {
 			return buf
 		}
 
-		val, found := abbreviations[buf]
+		if buf == "multisig" {
+			nd.createMultisig(scanner)
+			nd.printKeys()
+			continue
+		}
+
+		if buf == "receipts" {
+			nd.printReceipts()
+			nd.printKeys()
+			continue
+		}
+
+		val, found := nd.abbreviations[buf]
 
 		if found {
 			return val
 		}
 
+		if ValidAddress(buf) {
+			return buf
+		}
+
 		fmt.Println("Invalid key input! Please write a valide value")
 	}
 }
 
-func printKeys() {
-	populateAbbreviation()
+func (nd *Node) printReceipts() {
+	receipts := nd.Receipts()
+	if len(receipts) == 0 {
+		fmt.Println("No transactions sent")
+	}
+	for _, rc := range receipts {
+		fmt.Println(rc)
+	}
+}
+
+func (nd *Node) printKeys() {
+	nd.populateAbbreviation()
 
-	l := len(abbreviations)
+	l := len(nd.abbreviations)
 
 	for i := 0; i < l; i++ {
-		fmt.Printf("Input: " + strconv.Itoa(i) + "\t| Account: " + abbreviations[strconv.Itoa(i)][30:39] + "\n")
+		fmt.Printf("Input: " + strconv.Itoa(i) + "\t| Account: " + nd.abbreviations[strconv.Itoa(i)] + "\n")
 	}
 }
 
 // PopulateAbbreviation inserts the keys and their abbreviation in the abbreviation map
-func populateAbbreviation() {
-	p := gatherKeys()
+func (nd *Node) populateAbbreviation() {
+	p := nd.gatherKeys()
 
 	for i, c := range p {
-		abbreviations[strconv.Itoa(i)] = c
+		nd.abbreviations[strconv.Itoa(i)] = c
 	}
 }
 
-// GatherKeys returns all the pubkeys of the clients
-func gatherKeys() []string {
-	l := Tree.GetAccountNumbers()
+// GatherKeys returns all the addresses of the accounts and of the clients
+func (nd *Node) gatherKeys() []string {
+	l := nd.Tree.GetAccountNumbers()
 
-	for p := range PeerList.Iter() {
+	for _, p := range nd.PeerList.Snapshot() {
+		if p.PubKey == "" {
+			continue
+		}
 
+		address := AddressFromKey(p.PubKey)
 		found := false
 
 		for _, p1 := range l {
-			if p1 == p.PubKey {
+			if p1 == address {
 				found = true
 				break
 			}
 		}
 
 		if !found {
-			l = append(l, p.PubKey)
+			l = append(l, address)
 		}
 	}
 
 	return l
 }
 
-func scanPrivKey(scanner *bufio.Scanner) string {
+// scanPEMKey reads a key (public or secret) between the PEM delimiters
+func scanPEMKey(scanner *bufio.Scanner) string {
 	scanner.Scan()
 	buf := scanner.Text()
 
@@ -161,17 +299,18 @@ func scanPrivKey(scanner *bufio.Scanner) string {
 	scanner.Scan()
 	buf = scanner.Text()
 
+	// keep newlines as the key can have headers (e.g. its algorithm)
 	for buf != "-----END KEY-----" {
 		if buf == "quit" {
 			return buf
 		}
-		key += buf
+		key += buf + "\n"
 
 		scanner.Scan()
 		buf = scanner.Text()
 	}
 
-	key += "\n" + buf
+	key += buf
 
 	return key
 }
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+
+	. "../account"
+	bt "../blocktree"
+	. "../peers"
+)
+
+// The events of the services are logged on nd.Log with these fields, the interactive
+// prompt (see keyboard.go) writes to the standard output instead
+
+func peerAttr(p *Peer) slog.Attr {
+	return slog.String("peer", p.GetAddress())
+}
+
+// nodeAttrs describes a node by its slot, hash and the account of its creator
+func nodeAttrs(n *bt.Node) []any {
+	return []any{
+		slog.Uint64("slot", n.Slot),
+		slog.String("node", fmt.Sprintf("%x", bt.HashNode(n))),
+		slog.String("account", AddressFromKey(n.Peer))}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"net/http"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+	"../metrics"
+)
+
+// nodeMetrics are the counters updated by the services, see NewNode for their description
+type nodeMetrics struct {
+	received      *metrics.CounterVec
+	sent          *metrics.CounterVec
+	dropped       metrics.Counter
+	penalties     metrics.Counter
+	nodesCreated  metrics.Counter
+	slotsWon      metrics.Counter
+	equivocations metrics.Counter
+	verifyTx      *metrics.Histogram
+	verifyNode    *metrics.Histogram
+}
+
+func newNodeMetrics() *nodeMetrics {
+	return &nodeMetrics{
+		received:   metrics.NewCounterVec("type"),
+		sent:       metrics.NewCounterVec("type"),
+		verifyTx:   metrics.NewHistogram(metrics.DurationBuckets),
+		verifyNode: metrics.NewHistogram(metrics.DurationBuckets)}
+}
+
+// registerMetrics adds the metrics of the node and of its tree to nd.Metrics
+func (nd *Node) registerMetrics() {
+	r, m := nd.Metrics, nd.stats
+
+	r.Register("services_messages_received_total", "Messages received from the peers by type.", m.received)
+	r.Register("services_messages_sent_total", "Messages queued for the peers by type.", m.sent)
+	r.Register("services_messages_dropped_total", "Messages dropped because the queue of a slow peer was full.", &m.dropped)
+	r.Register("services_penalties_total", "Misbehaviours of the peers, see reputation.go.", &m.penalties)
+	r.Register("services_nodes_created_total", "Nodes created and signed by the local machine.", &m.nodesCreated)
+	r.Register("services_slots_won_total", "Slots whose winner was the node of the local machine.", &m.slotsWon)
+	r.Register("services_equivocations_total", "Equivocations detected or learned from the peers.", &m.equivocations)
+	r.Register("services_transaction_verification_seconds", "Time to verify the signatures of a transaction.", m.verifyTx)
+	r.Register("services_node_verification_seconds", "Time to verify the signature, the draw and the evidence of a node.", m.verifyNode)
+
+	r.Register("services_peers_known", "Peers known, the local machine included.", metrics.GaugeFunc(func() float64 {
+		return float64(nd.PeerList.Length())
+	}))
+	r.Register("services_peers_connected", "Peers with an open connection.", metrics.GaugeFunc(func() float64 {
+		connected := 0
+		for _, p := range nd.PeerList.Snapshot() {
+			if p.Connected() {
+				connected++
+			}
+		}
+		return float64(connected)
+	}))
+
+	nd.Tree.RegisterMetrics(r)
+}
+
+// ServeMetrics serves the metrics in the Prometheus text format on address (host:port) at /metrics
+func (nd *Node) ServeMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", nd.Metrics)
+
+	nd.serveHTTP(address, "Serving the metrics", "/metrics", mux)
+}
+
+// verifyTransaction checks the signatures of the transaction, timing it
+func (nd *Node) verifyTransaction(st SignedTransaction) bool {
+	defer nd.stats.verifyTx.ObserveSince(time.Now())
+	return st.VerifyTransaction()
+}
+
+// verifyNode checks the signature, the draw and the evidence of the node, timing it
+func (nd *Node) verifyNode(sn bt.SignedNode) bool {
+	defer nd.stats.verifyNode.ObserveSince(time.Now())
+	return sn.VerifyNode() && sn.Node.VerifyDraw() && sn.Node.VerifyEvidence()
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "../account"
+	"../transport"
+)
+
+func TestNodeMetrics(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	nd := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	st := SignTransaction(NewTransaction("1", nd.ownAccount(), "founder", 10), nd.signer)
+	if !nd.verifyTransaction(st) {
+		t.Fatal("Valid transaction rejected")
+	}
+
+	var buf bytes.Buffer
+	nd.Metrics.WriteText(&buf)
+	for _, line := range []string{
+		"services_transaction_verification_seconds_count 1",
+		"services_slots_won_total 0",
+		"blocktree_nodes 1",
+		"blocktree_head_slot 0"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Error("Missing", line, "in\n"+buf.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+)
+
+// proposalsKept is how many multisig accounts of received transactions wait for the inclusion, the oldest are dropped first
+const proposalsKept = 1000
+
+// proposalTTL is how long a multisig account waits for its transaction to be included in the chain of the head
+const proposalTTL = 10 * time.Minute
+
+// proposal is a multisig account carried by a received transaction
+type proposal struct {
+	account  MultisigAccount
+	received time.Time
+}
+
+// multisigProposals holds the multisig accounts of the received transactions until
+// their transaction is applied to the ledger of the head, anyone can send a valid
+// transaction from a new account so they are registered only then
+type multisigProposals struct {
+	byID  map[string]proposal // by ID of the transaction
+	order []string            // of arrival
+	lock  sync.Mutex
+}
+
+func newMultisigProposals() *multisigProposals {
+	return &multisigProposals{byID: map[string]proposal{}}
+}
+
+// propose keeps the account of a verified transaction
+func (m *multisigProposals) propose(id string, account MultisigAccount) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, found := m.byID[id]; found {
+		return
+	}
+	m.byID[id] = proposal{account: account, received: time.Now()}
+	m.order = append(m.order, id)
+
+	for len(m.order) > proposalsKept {
+		delete(m.byID, m.order[0])
+		m.order = m.order[1:]
+	}
+}
+
+// register registers the accounts whose transaction is in the chain of the head, forgetting the expired ones
+func (m *multisigProposals) register(tree *bt.Tree) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	kept := []string{}
+	for _, id := range m.order {
+		p := m.byID[id]
+		switch {
+		case tree.InChain(id):
+			tree.RegisterMultisig(p.account)
+			delete(m.byID, id)
+		case time.Since(p.received) > proposalTTL:
+			delete(m.byID, id)
+		default:
+			kept = append(kept, id)
+		}
+	}
+	m.order = kept
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+)
+
+func TestMultisigRegisteredOnceIncluded(t *testing.T) {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := aesrsa.VerifierToString(signer.Verifier())
+	founder := AddressFromKey(key)
+	tree := bt.NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", founder, 1e6)})
+
+	other, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	included, _ := NewMultisigAccount(1, []string{key})
+	dropped, _ := NewMultisigAccount(2, []string{key, aesrsa.VerifierToString(other.Verifier())})
+
+	m := newMultisigProposals()
+	tx := NewTransaction("1", included.Address(), "someone", 10)
+	m.propose("1", included)
+	m.propose("2", dropped)
+	tree.ConsiderTransaction(tx, nil)
+	m.register(tree)
+
+	if _, found := tree.GetMultisig(included.Address()); found {
+		t.Fatal("Multisig registered before its transaction is in the chain")
+	}
+
+	tree.ConsiderLeaf(bt.NewNode(42, 1, []string{"1"}, signer, tree.GetHead()))
+	m.register(tree)
+
+	if _, found := tree.GetMultisig(included.Address()); !found {
+		t.Error("Multisig of an included transaction not registered")
+	}
+	if _, found := tree.GetMultisig(dropped.Address()); found {
+		t.Error("Multisig of a transaction not included registered")
+	}
+	if len(m.order) != 1 || len(m.byID) != 1 {
+		t.Error("Registered proposal kept", m.order)
+	}
+
+	for i := 0; i < proposalsKept; i++ {
+		m.propose(fmt.Sprint("flood-", i), included)
+	}
+	if _, found := m.byID["2"]; found || len(m.order) != proposalsKept {
+		t.Error("Proposals not capped", len(m.order))
+	}
+}
@@ -1,197 +1,330 @@
 package services
 
 import (
-	"encoding/gob"
 	"errors"
-	"fmt"
 	"math/rand"
 	"net"
 	"time"
 
-	. "../account"
 	"../aesrsa"
-	bt "../blocktree"
 	. "../peers"
 )
 
-// LocalPeer is the ID of the local machine
-var LocalPeer Peer
-
-// PeerList os the list of peers known
-var PeerList = NewList()
-
 // InitNetwork preconfigures some basic properties of the network layer
 func InitNetwork() {
 	rand.Seed(time.Now().UnixNano())
+}
 
-	gob.Register(&bt.SignedNode{})
-	gob.Register(&SignedTransaction{})
+// Listen opens the socket accepting the other peers on address (host:port), the port 0 picks a free one
+func (nd *Node) Listen(address string) {
+	ln, err := nd.transport.Listen(address)
+	if err != nil {
+		nd.Log.Error("Could not listen", "address", address, "err", err)
+		panic(err.Error())
+	}
+	nd.listener = ln
 }
 
-// ConnectToNetwork connects the local machine to a pre-existing network
-func ConnectToNetwork(peer Peer, listenCh chan<- SignedTransaction, blockCh chan<- bt.SignedNode, localPK aesrsa.RSAKey) {
-	conn1, err := Connect(&peer)
+// ConnectToNetwork connects the local machine to a pre-existing network (Listen must be called),
+// advertise is the address announced to the other peers (see advertisedPeer)
+func (nd *Node) ConnectToNetwork(peer Peer, advertise string) {
+	nd.setLocalPeer(nd.advertisedPeer(advertise))
+
+	conn1, remoteKey, err := nd.secureConnect(&peer)
 
 	if err != nil {
 		panic(err.Error())
 	}
 
-	LocalPeer = GetLocalPeer(peer.Port+rand.Intn(1000), aesrsa.KeyToString(localPK))
-	fmt.Println("Connection to the network Succesfull")
-	PeerList.SortedInsert(&LocalPeer)
-	handleFirstConn(conn1, listenCh, blockCh)
-	fmt.Println("Your IP is:", LocalPeer.IP, "with open port:", LocalPeer.GetPort())
+	nd.PeerList.SortedInsert(nd.LocalPeer())
+	nd.handleFirstConn(conn1, remoteKey)
+	nd.Log.Info("Joined the network", "via", peer.GetAddress(), "ip", nd.LocalPeer().IP, "port", nd.LocalPeer().Port)
 }
 
-// CreateNetwork let the local machine create a p2p network
-func CreateNetwork(port int, listenCh chan<- SignedTransaction, blockCh chan<- bt.SignedNode, localPK aesrsa.RSAKey) {
-	LocalPeer = GetLocalPeer(port, aesrsa.KeyToString(localPK))
-	PeerList.SortedInsert(&LocalPeer)
-	fmt.Println("Initializing your own network")
-	fmt.Println("Your IP is:", LocalPeer.IP, "with open port:", LocalPeer.GetPort())
+// CreateNetwork let the local machine create a p2p network (Listen must be called)
+func (nd *Node) CreateNetwork(advertise string) {
+	nd.setLocalPeer(nd.advertisedPeer(advertise))
+	nd.PeerList.SortedInsert(nd.LocalPeer())
+	nd.Log.Info("Created a new network", "ip", nd.LocalPeer().IP, "port", nd.LocalPeer().Port)
 }
 
-// Connect starts a tcp connection given a peer
-func Connect(peer *Peer) (net.Conn, error) {
+// Connect starts a connection given a peer
+func (nd *Node) Connect(peer *Peer) (net.Conn, error) {
 	if peer.IP == "<nil>" {
 		return nil, errors.New("IP is not valid")
 	}
-	return net.Dial("tcp", peer.GetAddress())
+	return nd.transport.Dial(peer.GetAddress())
+}
+
+// secureConnect starts an encrypted connection given a peer, returning the proven key of the peer
+func (nd *Node) secureConnect(peer *Peer) (net.Conn, string, error) {
+	conn, err := nd.Connect(peer)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return nd.secure(conn, true)
 }
 
-func handleFirstConn(conn net.Conn, listenCh chan<- SignedTransaction, blockCh chan<- bt.SignedNode) {
-	enc := gob.NewEncoder(conn)
-	dec := gob.NewDecoder(conn)
+// secure wraps the connection in an authenticated and encrypted channel
+func (nd *Node) secure(conn net.Conn, initiator bool) (net.Conn, string, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sc, remoteKey, err := aesrsa.SecureConn(conn, nd.signer, initiator)
+	conn.SetDeadline(time.Time{})
 
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return sc, remoteKey, nil
+}
+
+func (nd *Node) handleFirstConn(conn net.Conn, remoteKey string) {
 	// asking for list of peers
-	signalAsk(enc)
+	hs, _, dec, err := nd.dialHandshake(conn, remoteKey, true)
+	if err != nil {
+		panic(err.Error())
+	}
+	nd.noteObserved(hs)
 
-	p := &Peer{}
-	err := dec.Decode(p)
-	for p.Port != -1 {
-		if err == nil {
-			PeerList.SortedInsert(p)
-		}
-		p = &Peer{}
-		err = dec.Decode(p)
+	var env Envelope
+	if err := dec.Decode(&env); err == nil && env.Type == PeersMsg {
+		nd.mergePeers(env.Peers)
 	}
 	conn.Close()
 
 	// broadcasting ourselves
-	i := 0
-	for p := range PeerList.IterWrap(&LocalPeer) {
-		if *p != LocalPeer {
-			if i >= 10 {
-				break
-			}
-			conn, err := Connect(p)
-			if err == nil {
-				p.AddConn(conn)
-				enc = p.GetEnc()
-				signalNoAsk(enc)
-				Wg.Add(1)
-				go handleConn(p, listenCh, blockCh)
-			}
-			i++
-		}
-	}
+	nd.fillConnections()
 }
 
-// ask for list of peers
-func signalAsk(enc *gob.Encoder) {
-	enc.Encode(Peer{IP: "", Port: -1})
-}
+// errAlreadyConnected is returned by dialPeer when the peer connected to us during the dial
+var errAlreadyConnected = errors.New("already connected")
 
-// signal not asking for list of peers
-func signalNoAsk(enc *gob.Encoder) {
-	enc.Encode(LocalPeer)
+// dialPeer connects to a known peer completing the handshake
+func (nd *Node) dialPeer(p *Peer) error {
+	conn, remoteKey, err := nd.secureConnect(p)
+	if err != nil {
+		return err
+	}
+	hs, enc, dec, err := nd.dialHandshake(conn, remoteKey, false)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	nd.noteObserved(hs)
+
+	// the peer may have connected to us meanwhile
+	if !nd.PeerList.Attach(p, conn, enc, dec, func(p *Peer) {
+		setHandshake(p, hs)
+		p.SetOutbound(true)
+	}) {
+		conn.Close()
+		return errAlreadyConnected
+	}
+	nd.noteClock(hs)
+	return nil
 }
 
 // BeServer let the local machine accept connections to the p2p network
-func BeServer(listenCh chan<- SignedTransaction, blockCh chan<- bt.SignedNode, quitCh <-chan struct{}) {
-	defer fmt.Println("server closed")
-	defer Wg.Done()
+func (nd *Node) BeServer() {
+	defer nd.Log.Info("Server closed")
+	defer nd.Wg.Done()
 
-	ln, err := net.Listen("tcp", ":"+LocalPeer.GetPort())
+	defer nd.listener.Close()
 
-	if err != nil {
-		fmt.Println("Fatal server error")
-		panic(-1)
-	}
-
-	defer ln.Close()
+	// closing the listener unblocks Accept
+	go func() {
+		<-nd.quitCh
+		nd.listener.Close()
+	}()
 
 	for {
-		conn, _ := ln.Accept()
-		select {
-		case _, open := <-quitCh:
-			if !open {
-				ln.Close()
-				closeAllConn()
+		conn, err := nd.listener.Accept()
+		if err != nil {
+			select {
+			case <-nd.quitCh:
+				nd.closeAllConn()
 				return //Done
+			default:
+				nd.Log.Warn("Could not accept a connection", "err", err)
+				continue
 			}
+		}
+
+		// a slow or silent dialer must not hold the others back
+		select {
+		case nd.handshakes <- struct{}{}:
+			nd.Wg.Add(1)
+			go nd.acceptConn(conn)
 		default:
-			if p, firstConn := checkAsk(conn); !firstConn {
-				Wg.Add(1)
-				go handleConn(p, listenCh, blockCh)
-			}
+			nd.Log.Info("Rejected connection", "remote", conn.RemoteAddr(), "err", "too many pending handshakes")
+			conn.Close()
 		}
 	}
+}
 
+// acceptConn completes the handshake of an inbound connection, freeing its place among the pending ones, and serves it
+func (nd *Node) acceptConn(conn net.Conn) {
+	defer nd.Wg.Done()
+
+	// closing the connection interrupts the handshake when quitting
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-nd.quitCh:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	p, firstConn := nd.checkAsk(conn)
+	<-nd.handshakes
+
+	if !firstConn {
+		nd.Wg.Add(1)
+		go nd.handleConn(p)
+	}
 }
 
-func closeAllConn() {
-	for conn := range PeerList.IterConn() {
+func (nd *Node) closeAllConn() {
+	for conn := range nd.PeerList.IterConn() {
 		conn.Close()
 	}
 }
 
-// check if the peer asks for list of peers
-func checkAsk(conn net.Conn) (*Peer, bool) {
-	dec := gob.NewDecoder(conn)
-	p := &Peer{}
-	err := dec.Decode(p)
-	if err == nil {
-		if p.Port == -1 {
-			enc := gob.NewEncoder(conn)
-
-			for p := range PeerList.Iter() {
-				enc.Encode(*p)
-			}
+// checkAsk completes the handshake and checks if the peer only asks for list of peers
+func (nd *Node) checkAsk(rawConn net.Conn) (*Peer, bool) {
+	if nd.isBanned(remoteIP(rawConn), "") {
+		nd.Log.Info("Rejected connection", "remote", rawConn.RemoteAddr(), "err", "banned")
+		rawConn.Close()
+		return &Peer{}, true
+	}
 
-			enc.Encode(Peer{Port: -1})
-			return &Peer{}, true
+	conn, remoteKey, err := nd.secure(rawConn, false)
+	if err != nil {
+		nd.Log.Info("Rejected connection", "remote", rawConn.RemoteAddr(), "err", err)
+		return &Peer{}, true
+	}
+
+	hs, enc, dec, err := nd.acceptHandshake(conn, remoteKey)
+	if err != nil {
+		nd.Log.Info("Rejected connection", "remote", conn.RemoteAddr(), "err", err)
+		conn.Close()
+		return &Peer{}, true
+	}
+	nd.noteObserved(hs)
+
+	if hs.AskPeers {
+		nd.sendPeers(enc)
+		conn.Close()
+		return &Peer{}, true
+	}
+
+	known := nd.PeerList.GetPeer(hs.address())
+	if known == nil {
+		p := peerFromHandshake(hs, conn, enc, dec)
+		nd.PeerList.SortedInsert(p)
+		if nd.PeerList.GetPeer(hs.address()) == p {
+			nd.noteClock(hs)
+			return p, false
 		}
-		p.AddConn(conn)
-		p.AddDec(dec)
-		PeerList.SortedInsert(p)
-		return p, false
+		// added meanwhile by another connection
+		known = nd.PeerList.GetPeer(hs.address())
+	}
+
+	// a known peer reconnecting, its entry is reused
+	if known == nil || !nd.PeerList.Attach(known, conn, enc, dec, func(p *Peer) {
+		setHandshake(p, hs)
+		p.SetOutbound(false)
+	}) {
+		// already connected, a second connection would be served untracked
+		nd.Log.Info("Closed a duplicate connection", "peer", hs.address())
+		conn.Close()
+		return &Peer{}, true
 	}
-	return &Peer{}, true
+	nd.noteClock(hs)
+	return known, false
 }
 
-func handleConn(peer *Peer, listenCh chan<- SignedTransaction, blockCh chan<- bt.SignedNode) {
-	defer Wg.Done()
-	defer peer.Close()
+func (nd *Node) handleConn(peer *Peer) {
+	defer nd.Wg.Done()
+	defer nd.PeerList.Disconnect(peer)
+	defer nd.inv.forgetRequests(peer.GetAddress())
+	defer nd.offsets.remove(peer.PubKey)
 
-	fmt.Println("Connected to", peer)
+	peer.StartWriter(sendQueueSize, writeTimeout)
+	nd.Log.Info("Connected", peerAttr(peer), "outbound", peer.IsOutbound())
+
+	// closing the connection unblocks the decoder when quitting
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-nd.quitCh:
+			peer.Close()
+		case <-closed:
+		}
+	}()
 
 	dec := peer.GetDec()
 
 	for {
-		var obj WhatType
-		err := dec.Decode(&obj)
+		var env Envelope
+		err := dec.Decode(&env)
 
 		if err != nil {
-			fmt.Println("Closed connection to", peer, "because of", err)
-			PeerList.Remove(peer)
+			if isMalformed(err) {
+				nd.penalize(peer, penaltyMalformed, err.Error())
+			}
+			// the peer stays known, MaintainConnections redials it
+			nd.Log.Info("Connection closed", peerAttr(peer), "err", err)
 			break //Done
 		} else {
-			switch obj.WhatType() {
-			case "SignedTransaction":
-				listenCh <- *obj.(*SignedTransaction)
-			case "SignedNode":
-				blockCh <- *obj.(*bt.SignedNode)
+			nd.PeerList.Seen(peer, time.Now())
+			nd.stats.received.With(env.Type.String()).Inc()
+
+			switch {
+			case env.Type == PeersMsg && len(env.Peers) <= maxGossipPeers:
+				nd.mergePeers(env.Peers)
+			case (env.Type == InvMsg || env.Type == GetDataMsg) && len(env.Inventory) > maxInvItems:
+				nd.penalize(peer, penaltySpam, "too many items")
+			case env.Type == InvMsg:
+				nd.handleInv(peer, env.Inventory)
+			case env.Type == GetDataMsg:
+				nd.handleGetData(peer, env.Inventory)
+			case env.Type == TransactionMsg && env.Transaction != nil:
+				if st := env.Transaction; !nd.inv.known(txItem(st)) {
+					if !nd.verifyTransaction(*st) {
+						nd.penalize(peer, penaltyInvalidTx, "invalid transaction")
+						continue
+					}
+					nd.Submit(*st)
+				}
+			case env.Type == NodeMsg && env.Node != nil:
+				if sn := env.Node; !nd.inv.known(nodeItem(sn)) {
+					if !nd.verifyNode(*sn) {
+						nd.penalize(peer, penaltyInvalidNode, "invalid node")
+						continue
+					}
+					select {
+					case nd.blockCh <- *sn:
+					case <-nd.quitCh:
+					}
+				}
+			case env.Type == EvidenceMsg && env.Evidence != nil:
+				if ev := env.Evidence; !nd.inv.known(evidenceItem(ev)) {
+					if !ev.Verify() {
+						nd.penalize(peer, penaltyInvalidNode, "invalid evidence")
+						continue
+					}
+					select {
+					case nd.evidenceCh <- *ev:
+					case <-nd.quitCh:
+					}
+				}
+			default:
+				nd.penalize(peer, penaltySpam, "unexpected message")
 			}
 		}
 	}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+	"../agent"
+	bt "../blocktree"
+	"../metrics"
+	. "../peers"
+	"../transport"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Node is a participant of the network, it holds the state of all the services
+// so that several nodes can run in the same process (see transport.Mem)
+type Node struct {
+	// PeerList is the list of peers known
+	PeerList *AtomicSortedSlice
+	// Tree is the blockchain tree
+	Tree *bt.Tree
+	// Bans are the addresses banned for misbehaving
+	Bans *BanList
+	// SigningAgent holds the keys of the user if connected
+	SigningAgent *agent.Client
+	// Adversary is the way the node misbehaves on purpose, Honest by default
+	Adversary Adversary
+	// Log receives the events of the services, slog.Default() unless set
+	Log *slog.Logger
+	// Metrics are the metrics of the node and of its tree, see ServeMetrics
+	Metrics *metrics.Registry
+	// Wg is the waitgroup for all the services
+	Wg sync.WaitGroup
+
+	transport  transport.Transport
+	listener   net.Listener
+	handshakes chan struct{} // the inbound connections completing the handshake, see BeServer
+	signer     aesrsa.Signer // authenticates the links and signs the nodes
+
+	past    *PastMap
+	inv     *inventory
+	offsets *timeOffsets
+	stats   *nodeMetrics
+
+	receipts  *receipts
+	multisigs *multisigProposals
+	events    *eventStreams
+
+	local     *Peer // see LocalPeer
+	localLock sync.RWMutex
+
+	redials     map[string]*redial
+	redialsLock sync.Mutex
+
+	advertiseFixed bool
+	observed       map[string]map[string]bool
+	observedLock   sync.Mutex
+
+	abbreviations map[string]string
+
+	listenCh    chan SignedTransaction
+	blockCh     chan bt.SignedNode
+	evidenceCh  chan bt.Evidence
+	sequencerCh chan Transaction
+	quitCh      chan struct{}
+	quitOnce    sync.Once
+}
+
+// NewNode is the constructor of the Node type, signer is the key of the local machine
+func NewNode(tree *bt.Tree, signer aesrsa.Signer, tr transport.Transport) *Node {
+	nd := &Node{
+		PeerList:      NewList(),
+		local:         &Peer{},
+		Tree:          tree,
+		Log:           slog.Default(),
+		Metrics:       metrics.NewRegistry(),
+		Bans:          NewBanList(""),
+		transport:     tr,
+		handshakes:    make(chan struct{}, maxPendingHandshakes),
+		signer:        signer,
+		past:          NewPastMap(),
+		inv:           newInventory(),
+		offsets:       newTimeOffsets(),
+		stats:         newNodeMetrics(),
+		receipts:      newReceipts(),
+		multisigs:     newMultisigProposals(),
+		events:        newEventStreams(),
+		redials:       make(map[string]*redial),
+		observed:      make(map[string]map[string]bool),
+		abbreviations: make(map[string]string),
+		listenCh:      make(chan SignedTransaction),
+		blockCh:       make(chan bt.SignedNode),
+		evidenceCh:    make(chan bt.Evidence),
+		sequencerCh:   make(chan Transaction),
+		quitCh:        make(chan struct{})}
+
+	nd.registerMetrics()
+	return nd
+}
+
+// Start runs the services in background, transactions and nodes are processed once connected to a peer
+func (nd *Node) Start() {
+	nd.Wg.Add(4)
+	go nd.BeServer()
+	go nd.MaintainConnections()
+	go nd.ExchangePeers()
+
+	go func() {
+		defer nd.Wg.Done()
+
+		if !nd.WaitForPeers() {
+			return
+		}
+		nd.Wg.Add(2)
+		go nd.ProcessTransactions()
+		go nd.ProcessNodes()
+
+		if nd.Adversary == InvalidTx || nd.Adversary == DoubleSpend {
+			nd.Wg.Add(1)
+			go nd.Misbehave()
+		}
+	}()
+}
+
+// WaitForPeers waits until another peer is known, returns false if the node quits before
+func (nd *Node) WaitForPeers() bool {
+	err := wait.PollUntil(time.Millisecond*100, wait.ConditionFunc(func() (bool, error) {
+		return nd.PeerList.Length() > 1, nil
+	}), nd.quitCh)
+
+	return err == nil
+}
+
+// Submit sends a signed transaction to the node as if received from a peer
+func (nd *Node) Submit(st SignedTransaction) {
+	select {
+	case nd.listenCh <- st:
+	case <-nd.quitCh:
+	}
+}
+
+// LocalPeer is the ID of the local machine, it must not be modified: it is replaced
+// when the address advertised changes
+func (nd *Node) LocalPeer() *Peer {
+	nd.localLock.RLock()
+	defer nd.localLock.RUnlock()
+
+	return nd.local
+}
+
+func (nd *Node) setLocalPeer(p *Peer) {
+	nd.localLock.Lock()
+	defer nd.localLock.Unlock()
+
+	nd.local = p
+}
+
+// Quit asks the services to stop
+func (nd *Node) Quit() {
+	nd.quitOnce.Do(func() { close(nd.quitCh) })
+}
+
+// Wait waits for the node to quit and the services to stop
+func (nd *Node) Wait() {
+	<-nd.quitCh
+	nd.Wg.Wait()
+}
+
+// Stop stops the services and waits for them
+func (nd *Node) Stop() {
+	nd.Quit()
+	nd.Wg.Wait()
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+	. "../peers"
+	"../transport"
+)
+
+func newTestNode(t *testing.T, mem *transport.Mem, host string, genesis []Transaction) *Node {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewNode(bt.NewTree(genesis), signer, mem.Host(host))
+}
+
+func TestNodesConnectInMemory(t *testing.T) {
+	mem := transport.NewMem(1)
+	mem.SetLatency(5*time.Millisecond, 5*time.Millisecond)
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+
+	a := newTestNode(t, mem, "10.0.0.1", genesis)
+	a.Listen("10.0.0.1:4444")
+	a.CreateNetwork("10.0.0.1:")
+	a.Start()
+
+	b := newTestNode(t, mem, "10.0.0.2", genesis)
+	b.Listen("10.0.0.2:0")
+	b.ConnectToNetwork(Peer{IP: "10.0.0.1", Port: 4444}, "10.0.0.2:")
+	b.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for a.PeerList.GetPeer(b.LocalPeer().GetAddress()) == nil || !a.PeerList.GetPeer(b.LocalPeer().GetAddress()).Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("Nodes did not connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.Stop()
+		b.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Nodes did not stop")
+	}
+}
+
+func TestSilentDialerDoesNotBlockOthers(t *testing.T) {
+	mem := transport.NewMem(1)
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+
+	a := newTestNode(t, mem, "10.0.0.1", genesis)
+	a.Listen("10.0.0.1:4444")
+	a.CreateNetwork("10.0.0.1:")
+	a.Start()
+
+	// connects and never completes the handshake
+	silent, err := mem.Host("10.0.0.9").Dial("10.0.0.1:4444")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	b := newTestNode(t, mem, "10.0.0.2", genesis)
+	b.Listen("10.0.0.2:0")
+	joined := make(chan struct{})
+	go func() {
+		b.ConnectToNetwork(Peer{IP: "10.0.0.1", Port: 4444}, "10.0.0.2:")
+		close(joined)
+	}()
+
+	select {
+	case <-joined:
+	case <-time.After(handshakeTimeout / 2):
+		t.Fatal("Handshake held back by a silent dialer")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.Stop()
+		b.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(handshakeTimeout / 2):
+		t.Fatal("Nodes did not stop during a pending handshake")
+	}
+}
+
+func TestKnownAddressChangesKeyOnlyFromItsIP(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	known := &Peer{IP: "10.0.0.2", Port: 4444, PubKey: "key of b"}
+	a.PeerList.SortedInsert(known)
+
+	hs := &Handshake{
+		Version: ProtocolVersion,
+		Network: a.Tree.GetGenesisID(),
+		PubKey:  "key of c",
+		IP:      "10.0.0.2",
+		Port:    4444}
+	if err := a.checkHandshake(hs, "key of c", "10.0.0.9"); err == nil {
+		t.Error("Address of a known peer taken by another key from elsewhere")
+	}
+
+	// the peer restarted with a new key
+	if err := a.checkHandshake(hs, "key of c", "10.0.0.2"); err != nil {
+		t.Error("New key of a known peer rejected from its address", err)
+	}
+	setHandshake(known, hs)
+	if known.PubKey != "key of c" {
+		t.Error("Key of a known peer not replaced", known.PubKey)
+	}
+}
+
+func TestBannedKeyRejectedOnAnotherAddress(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	a.ban(&Peer{IP: "10.0.0.2", Port: 4444, PubKey: "key of b"})
+
+	hs := &Handshake{
+		Version: ProtocolVersion,
+		Network: a.Tree.GetGenesisID(),
+		PubKey:  "key of b",
+		IP:      "10.0.0.3",
+		Port:    5555}
+	if err := a.checkHandshake(hs, "key of b", "10.0.0.3"); err == nil {
+		t.Error("Banned key accepted on another address")
+	}
+}
+
+func TestObservedAddressNeedsDistinctKeys(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+	a.Listen("10.0.0.1:4444")
+	a.CreateNetwork("")
+	old := a.LocalPeer()
+
+	// one key claiming two addresses is a single observer
+	a.noteObserved(&Handshake{PubKey: "key of b", IP: "10.0.0.2", Port: 4444, Observed: "198.51.100.7:4444"})
+	a.noteObserved(&Handshake{PubKey: "key of b", IP: "10.0.0.3", Port: 4444, Observed: "198.51.100.7:4444"})
+	if a.LocalPeer().IP == "198.51.100.7" {
+		t.Fatal("Observed address advertised on the word of a single key")
+	}
+
+	a.noteObserved(&Handshake{PubKey: "key of c", IP: "10.0.0.4", Port: 4444, Observed: "198.51.100.7:4444"})
+	local := a.LocalPeer()
+	if local.IP != "198.51.100.7" || local.Port != old.Port || local.PubKey != old.PubKey {
+		t.Fatal("Observed address not advertised", local)
+	}
+	if old.IP == local.IP || a.PeerList.GetPeer(local.GetAddress()) != local || a.PeerList.GetPeer(old.GetAddress()) != nil {
+		t.Error("Local peer not replaced in the list")
+	}
+}
+
+func TestGossipedKeysIgnored(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+	a.Bans.Ban("key of b", time.Hour)
+
+	// a neighbour pins a banned key on an honest address
+	a.mergePeers([]Peer{{IP: "10.0.0.2", Port: 4444, PubKey: "key of b", LastSeen: time.Now()}})
+
+	p := a.PeerList.GetPeer("10.0.0.2:4444")
+	if p == nil {
+		t.Fatal("Peer dropped for the key claimed by the gossip")
+	}
+	if p.PubKey != "" {
+		t.Error("Key taken from the gossip", p.PubKey)
+	}
+}
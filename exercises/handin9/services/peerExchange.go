@@ -0,0 +1,78 @@
+package services
+
+import (
+	"time"
+
+	. "../peers"
+)
+
+// peerExchangeInterval is how often the known peers are gossiped to the neighbours
+const peerExchangeInterval = 30 * time.Second
+
+// peerExpiry is how long a peer that was not seen is remembered and gossiped
+const peerExpiry = 30 * time.Minute
+
+// maxGossipPeers is the maximum number of peers sent in a message
+const maxGossipPeers = 100
+
+// ExchangePeers periodically sends the most recently seen peers to the neighbours,
+// so that every node eventually knows the whole network
+func (nd *Node) ExchangePeers() {
+	defer nd.Wg.Done()
+
+	ticker := time.NewTicker(peerExchangeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			nd.PeerList.Seen(nd.LocalPeer(), time.Now())
+			if removed := nd.PeerList.Prune(time.Now().Add(-peerExpiry)); removed > 0 {
+				nd.Log.Debug("Forgot the peers not seen recently", "count", removed, "expiry", peerExpiry)
+			}
+			nd.gossipPeers()
+		case <-nd.quitCh:
+			return //Done
+		}
+	}
+}
+
+func (nd *Node) gossipPeers() {
+	nd.sendAll(Envelope{Type: PeersMsg, Peers: nd.knownPeers()})
+}
+
+// knownPeers returns the most recently seen peers, the local one included
+func (nd *Node) knownPeers() []Peer {
+	nd.PeerList.Seen(nd.LocalPeer(), time.Now())
+
+	peers := nd.PeerList.Snapshot()
+	if len(peers) > maxGossipPeers {
+		peers = peers[:maxGossipPeers]
+	}
+	return peers
+}
+
+// mergePeers adds the peers received from a neighbour to the list, discarding invalid and expired ones.
+// The keys are dropped: the neighbour could lie about them, they are learned on the handshakes
+func (nd *Node) mergePeers(peers []Peer) {
+	now := time.Now()
+	valid := []Peer{}
+
+	for _, p := range peers {
+		switch {
+		case p.IP == "<nil>" || p.Port <= 0 || p.Port > 65535:
+		case p.GetAddress() == nd.LocalPeer().GetAddress():
+		case nd.isBanned(p.IP, ""):
+		case now.Sub(p.LastSeen) > peerExpiry:
+		default:
+			if p.LastSeen.After(now) {
+				p.LastSeen = now
+			}
+			valid = append(valid, Peer{IP: p.IP, Port: p.Port, LastSeen: p.LastSeen})
+		}
+	}
+
+	if added := nd.PeerList.Merge(valid); added > 0 {
+		nd.Log.Debug("Learned new peers", "count", added)
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+	. "../peers"
+)
+
+// ProtocolVersion is the version of the wire protocol, peers with a different one are rejected
+const ProtocolVersion = 2
+
+// handshakeTimeout is the time a new connection has to complete the handshake
+const handshakeTimeout = 10 * time.Second
+
+// maxPendingHandshakes is the number of inbound connections completing the handshake at once, the others are refused
+const maxPendingHandshakes = 64
+
+// capabilities are the features supported by the local node
+var capabilities = []string{"transactions", "nodes", "evidence"}
+
+// MessageType is the type of the content of an Envelope
+type MessageType int
+
+// Types of messages
+const (
+	HandshakeMsg MessageType = iota
+	RejectMsg
+	PeersMsg
+	TransactionMsg
+	NodeMsg
+	InvMsg     // announce of transactions and nodes by hash
+	GetDataMsg // request of the bodies of announced items
+	EvidenceMsg
+)
+
+var messageNames = []string{"handshake", "reject", "peers", "transaction", "node", "inv", "getdata", "evidence"}
+
+func (t MessageType) String() string {
+	if t < 0 || int(t) >= len(messageNames) {
+		return "unknown"
+	}
+	return messageNames[t]
+}
+
+// Handshake is the first message sent on every connection by both sides
+type Handshake struct {
+	Version      int
+	Network      string // ID of the genesis node
+	PubKey       string
+	IP           string
+	Port         int // listening port
+	Capabilities []string
+	AskPeers     bool   // the connection is only used to get the list of peers
+	Observed     string // address of the remote end as seen by the sender
+	Time         int64  // clock of the sender in nanoseconds, see timeOffset.go
+
+	received time.Time // when it was received (the middle of the round trip if we sent ours first), not sent
+}
+
+// address returns the listening address declared in the handshake
+func (hs *Handshake) address() string {
+	return net.JoinHostPort(hs.IP, strconv.Itoa(hs.Port))
+}
+
+// Envelope is the message exchanged by peers, only the field matching Type is set
+type Envelope struct {
+	Type        MessageType
+	Handshake   *Handshake
+	Reject      string
+	Peers       []Peer
+	Transaction *SignedTransaction
+	Node        *bt.SignedNode
+	Inventory   []InvItem
+	Evidence    *bt.Evidence
+}
+
+// localHandshake describes the local node to the remote end of conn
+func (nd *Node) localHandshake(conn net.Conn, askPeers bool) *Handshake {
+	return &Handshake{
+		Version:      ProtocolVersion,
+		Network:      nd.Tree.GetGenesisID(),
+		PubKey:       nd.LocalPeer().PubKey,
+		IP:           nd.LocalPeer().IP,
+		Port:         nd.LocalPeer().Port,
+		Capabilities: capabilities,
+		AskPeers:     askPeers,
+		Observed:     conn.RemoteAddr().String(),
+		Time:         nd.Tree.Clock.Now().UnixNano()}
+}
+
+// checkHandshake returns an error if the remote peer, connected from remoteIP, can't be part of our network:
+// it claims a key different from the one proven by the secure channel, or an address known with another key
+// from elsewhere (from the address itself, it is the peer restarted with a new key)
+func (nd *Node) checkHandshake(hs *Handshake, remoteKey, remoteIP string) error {
+	if hs.PubKey != remoteKey {
+		return errors.New("public key differs from the one of the secure channel")
+	}
+	if key := nd.PeerList.GetKey(hs.address()); key != "" && key != hs.PubKey && hs.IP != remoteIP {
+		return errors.New("address " + hs.address() + " belongs to another key")
+	}
+	if hs.Version != ProtocolVersion {
+		return fmt.Errorf("protocol version %d instead of %d", hs.Version, ProtocolVersion)
+	}
+	if hs.Network != nd.Tree.GetGenesisID() {
+		return errors.New("different network (genesis " + hs.Network + ")")
+	}
+	if nd.isBanned("", remoteKey) {
+		return errors.New("banned")
+	}
+	return nil
+}
+
+// peerFromHandshake creates the peer described by the handshake using the given connection
+func peerFromHandshake(hs *Handshake, conn net.Conn, enc *gob.Encoder, dec *gob.Decoder) *Peer {
+	p := &Peer{
+		IP:   hs.IP,
+		Port: hs.Port}
+	p.AddConn(conn)
+	p.AddEnc(enc)
+	p.AddDec(dec)
+	setHandshake(p, hs)
+	return p
+}
+
+// setHandshake updates a peer with what it declared in the handshake, the key is the one proven
+// (and checked by checkHandshake)
+func setHandshake(p *Peer, hs *Handshake) {
+	p.AddPubKey(hs.PubKey)
+	p.AddCapabilities(hs.Capabilities)
+	p.LastSeen = time.Now()
+}
+
+// dialHandshake sends our handshake on a new connection and waits for the answer of the remote peer
+func (nd *Node) dialHandshake(conn net.Conn, remoteKey string, askPeers bool) (*Handshake, *gob.Encoder, *gob.Decoder, error) {
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	sent := nd.Tree.Clock.Now()
+	if err := enc.Encode(Envelope{Type: HandshakeMsg, Handshake: nd.localHandshake(conn, askPeers)}); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var env Envelope
+	if err := dec.Decode(&env); err != nil {
+		return nil, nil, nil, err
+	}
+	received := sent.Add(nd.Tree.Clock.Now().Sub(sent) / 2)
+
+	switch {
+	case env.Type == RejectMsg:
+		return nil, nil, nil, errors.New("rejected by peer: " + env.Reject)
+	case env.Type != HandshakeMsg || env.Handshake == nil:
+		return nil, nil, nil, errors.New("peer did not answer with a handshake")
+	}
+
+	if err := nd.checkHandshake(env.Handshake, remoteKey, remoteIP(conn)); err != nil {
+		return nil, nil, nil, err
+	}
+	env.Handshake.received = received
+
+	return env.Handshake, enc, dec, nil
+}
+
+// acceptHandshake waits for the handshake of a remote peer, rejecting it if incompatible
+func (nd *Node) acceptHandshake(conn net.Conn, remoteKey string) (*Handshake, *gob.Encoder, *gob.Decoder, error) {
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	var env Envelope
+	if err := dec.Decode(&env); err != nil {
+		return nil, nil, nil, err
+	}
+	received := nd.Tree.Clock.Now()
+
+	if env.Type != HandshakeMsg || env.Handshake == nil {
+		enc.Encode(Envelope{Type: RejectMsg, Reject: "expected handshake"})
+		return nil, nil, nil, errors.New("peer did not start with a handshake")
+	}
+
+	if err := nd.checkHandshake(env.Handshake, remoteKey, remoteIP(conn)); err != nil {
+		enc.Encode(Envelope{Type: RejectMsg, Reject: err.Error()})
+		return nil, nil, nil, err
+	}
+
+	if err := enc.Encode(Envelope{Type: HandshakeMsg, Handshake: nd.localHandshake(conn, false)}); err != nil {
+		return nil, nil, nil, err
+	}
+	env.Handshake.received = received
+
+	return env.Handshake, enc, dec, nil
+}
+
+// sendPeers sends the list of known peers
+func (nd *Node) sendPeers(enc *gob.Encoder) error {
+	return enc.Encode(Envelope{Type: PeersMsg, Peers: nd.knownPeers()})
+}
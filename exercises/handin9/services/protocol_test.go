@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/gob"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "../account"
+	. "../peers"
+	"../transport"
+)
+
+// acceptEnvelope sends env as the first message to a accepting a connection from key,
+// returns the answer of a and the error of the handshake
+func acceptEnvelope(t *testing.T, a *Node, env Envelope, key string) (Envelope, error) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, _, err := a.acceptHandshake(local, key)
+		errCh <- err
+	}()
+
+	if err := gob.NewEncoder(remote).Encode(env); err != nil {
+		t.Fatal(err)
+	}
+	var answer Envelope
+	if err := gob.NewDecoder(remote).Decode(&answer); err != nil {
+		t.Fatal(err)
+	}
+	return answer, <-errCh
+}
+
+// dialEnvelope answers the handshake of a dialing a peer with key with env, returns the error of the handshake
+func dialEnvelope(t *testing.T, a *Node, env Envelope, key string) error {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, _, err := a.dialHandshake(local, key, false)
+		errCh <- err
+	}()
+
+	var hs Envelope
+	if err := gob.NewDecoder(remote).Decode(&hs); err != nil {
+		t.Fatal(err)
+	}
+	if hs.Type != HandshakeMsg || hs.Handshake == nil {
+		t.Fatal("Dial did not start with a handshake", hs.Type)
+	}
+	if err := gob.NewEncoder(remote).Encode(env); err != nil {
+		t.Fatal(err)
+	}
+	return <-errCh
+}
+
+func TestHandshakeAccepted(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	hs := &Handshake{Version: ProtocolVersion, Network: a.Tree.GetGenesisID(), PubKey: "key of b", IP: "10.0.0.2", Port: 4444}
+	answer, err := acceptEnvelope(t, a, Envelope{Type: HandshakeMsg, Handshake: hs}, "key of b")
+	if err != nil || answer.Type != HandshakeMsg || answer.Handshake == nil {
+		t.Fatal("Valid handshake not answered", err, answer.Type)
+	}
+
+	if err := dialEnvelope(t, a, Envelope{Type: HandshakeMsg, Handshake: hs}, "key of b"); err != nil {
+		t.Error("Valid answer to the handshake refused", err)
+	}
+}
+
+func TestIncompatibleHandshakesRejected(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	valid := Handshake{Version: ProtocolVersion, Network: a.Tree.GetGenesisID(), PubKey: "key of b", IP: "10.0.0.2", Port: 4444}
+	oldVersion, otherNetwork := valid, valid
+	oldVersion.Version--
+	otherNetwork.Network = "another genesis"
+
+	cases := []struct {
+		name   string
+		env    Envelope
+		reason string
+	}{
+		{"message before the handshake", Envelope{Type: PeersMsg}, "expected handshake"},
+		{"empty handshake", Envelope{Type: HandshakeMsg}, "expected handshake"},
+		{"other version", Envelope{Type: HandshakeMsg, Handshake: &oldVersion}, "protocol version"},
+		{"other network", Envelope{Type: HandshakeMsg, Handshake: &otherNetwork}, "different network"},
+	}
+
+	for _, c := range cases {
+		answer, err := acceptEnvelope(t, a, c.env, "key of b")
+		if err == nil {
+			t.Error("Accepted", c.name)
+		}
+		if answer.Type != RejectMsg || !strings.Contains(answer.Reject, c.reason) {
+			t.Error("Wrong answer to", c.name, answer.Type, answer.Reject)
+		}
+
+		// the same answers to our handshake
+		if err := dialEnvelope(t, a, c.env, "key of b"); err == nil {
+			t.Error("Dial accepted", c.name)
+		}
+	}
+
+	if err := dialEnvelope(t, a, Envelope{Type: RejectMsg, Reject: "banned"}, "key of b"); err == nil || !strings.Contains(err.Error(), "rejected by peer: banned") {
+		t.Error("Rejection of the peer not reported", err)
+	}
+}
+
+func TestEnvelopesDispatched(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go io.Copy(io.Discard, remote)
+
+	hs := &Handshake{PubKey: "key of b", IP: "10.0.0.2", Port: 4444}
+	p := peerFromHandshake(hs, local, gob.NewEncoder(local), gob.NewDecoder(local))
+	a.PeerList.SortedInsert(p)
+	a.Wg.Add(1)
+	go a.handleConn(p)
+	defer a.Stop()
+
+	enc := gob.NewEncoder(remote)
+	for _, env := range []Envelope{
+		{Type: PeersMsg, Peers: []Peer{{IP: "10.0.0.3", Port: 4444, LastSeen: time.Now()}}},
+		{Type: HandshakeMsg, Handshake: hs},
+		{Type: InvMsg, Inventory: make([]InvItem, maxInvItems+1)},
+	} {
+		if err := enc.Encode(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Score() > -2*penaltySpam {
+		if time.Now().After(deadline) {
+			t.Fatal("Unexpected and oversized messages not penalized", p.Score())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p.Score() != -2*penaltySpam {
+		t.Error("Wrong penalty", p.Score())
+	}
+	if a.PeerList.GetPeer("10.0.0.3:4444") == nil {
+		t.Error("Gossiped peer not merged")
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+)
+
+// receiptsKept is how many receipts are kept, the oldest final ones are forgotten first
+const receiptsKept = 1000
+
+// finalDepth is the depth at which an included transaction is not followed anymore
+const finalDepth = 20
+
+// ReceiptStatus is the stage of the lifecycle of a transaction submitted by the local machine
+type ReceiptStatus string
+
+// A transaction is pending until included in the chain of the head, it is reverted if the head
+// moves to a branch without it (it can be included again), rejected if this node refused it
+// (another node may still include it)
+const (
+	Pending  ReceiptStatus = "pending"
+	Included ReceiptStatus = "included"
+	Rejected ReceiptStatus = "rejected"
+	Reverted ReceiptStatus = "reverted"
+)
+
+// Receipt describes what happened to a transaction submitted by the local machine
+type Receipt struct {
+	Transaction Transaction
+	Submitted   time.Time
+	Status      ReceiptStatus
+	Reason      string `json:",omitempty"` // of the rejection
+	Node        string `json:",omitempty"` // hash of the node including it
+	Slot        uint64 `json:",omitempty"` // of the node
+	Depth       uint64 // nodes on top of the one including it, up to finalDepth
+}
+
+// final returns true if the receipt is not followed anymore
+func (r *Receipt) final() bool {
+	return r.Status == Rejected || (r.Status == Included && r.Depth >= finalDepth)
+}
+
+func (r Receipt) String() string {
+	s := fmt.Sprintf("%s: %s", r.Transaction.ID, r.Status)
+
+	switch r.Status {
+	case Included:
+		s += fmt.Sprintf(" in node %.16s of slot %d at depth %d", r.Node, r.Slot, r.Depth)
+	case Rejected:
+		s += " (" + r.Reason + ")"
+	case Reverted:
+		s += fmt.Sprintf(", node %.16s of slot %d left the chain", r.Node, r.Slot)
+	}
+	return s
+}
+
+// receipts tracks the transactions submitted by the local machine
+type receipts struct {
+	byID   map[string]*Receipt
+	order  []string        // of submission
+	active map[string]bool // IDs of the receipts not final
+	lock   sync.RWMutex
+}
+
+func newReceipts() *receipts {
+	return &receipts{
+		byID:   map[string]*Receipt{},
+		active: map[string]bool{}}
+}
+
+// track starts following the transaction
+func (r *receipts) track(t Transaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.byID[t.ID]; found {
+		return
+	}
+	r.byID[t.ID] = &Receipt{
+		Transaction: t,
+		Submitted:   time.Now(),
+		Status:      Pending}
+	r.order = append(r.order, t.ID)
+	r.active[t.ID] = true
+
+	for len(r.order) > receiptsKept {
+		r.forgetOldest()
+	}
+}
+
+// forgetOldest removes the oldest final receipt, or the oldest one if none is final
+func (r *receipts) forgetOldest() {
+	i := 0
+	for j, id := range r.order {
+		if r.byID[id].final() {
+			i = j
+			break
+		}
+	}
+
+	id := r.order[i]
+	delete(r.byID, id)
+	delete(r.active, id)
+	r.order = append(r.order[:i], r.order[i+1:]...)
+}
+
+// reject marks a pending transaction as refused, the others are not tracked or already further
+func (r *receipts) reject(id, reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if rc, found := r.byID[id]; found && rc.Status == Pending {
+		rc.Status = Rejected
+		rc.Reason = reason
+		delete(r.active, id)
+	}
+}
+
+// refresh updates the transactions included in or reverted from the chain of the head,
+// the final ones are not looked up anymore
+func (r *receipts) refresh(tree *bt.Tree) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for id := range r.active {
+		rc := r.byID[id]
+		n, depth, found := tree.Inclusion(rc.Transaction.ID)
+		switch {
+		case found:
+			rc.Status = Included
+			rc.Reason = ""
+			rc.Node = fmt.Sprintf("%x", bt.HashNode(n))
+			rc.Slot = n.Slot
+			rc.Depth = depth
+		case rc.Status == Included:
+			rc.Status = Reverted
+			rc.Depth = 0
+		}
+
+		if rc.final() {
+			delete(r.active, id)
+		}
+	}
+}
+
+func (r *receipts) get(id string) (Receipt, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	rc, found := r.byID[id]
+	if !found {
+		return Receipt{}, false
+	}
+	return *rc, true
+}
+
+// list returns all the receipts in order of submission
+func (r *receipts) list() []Receipt {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	list := []Receipt{}
+	for _, id := range r.order {
+		list = append(list, *r.byID[id])
+	}
+	return list
+}
+
+// Track follows the lifecycle of a transaction submitted by the local machine, see Receipt
+func (nd *Node) Track(st SignedTransaction) {
+	nd.receipts.track(st.ExtractTransaction())
+}
+
+// Receipt returns the receipt of a transaction passed to Track
+func (nd *Node) Receipt(id string) (Receipt, bool) {
+	return nd.receipts.get(id)
+}
+
+// Receipts returns the receipts of all the transactions passed to Track
+func (nd *Node) Receipts() []Receipt {
+	return nd.receipts.list()
+}
+
+// handleReceipts sends the receipts as JSON, only the one of the query parameter id if given
+func (nd *Node) handleReceipts(w http.ResponseWriter, r *http.Request) {
+	list := nd.Receipts()
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		rc, found := nd.Receipt(id)
+		if !found {
+			http.Error(w, "unknown transaction "+id, http.StatusNotFound)
+			return
+		}
+		list = []Receipt{rc}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
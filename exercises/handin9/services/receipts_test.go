@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+)
+
+func TestReceiptsFollowTheChain(t *testing.T) {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	founder := AddressFromKey(aesrsa.VerifierToString(signer.Verifier()))
+	tree := bt.NewTree([]Transaction{NewTransaction("Genesis - 0", "Genesis", founder, 1e6)})
+	genesis := tree.GetHead()
+
+	r := newReceipts()
+	tx := NewTransaction("1", founder, "someone", 10)
+	r.track(tx)
+	r.track(NewTransaction("2", founder, "someone", 10))
+	r.reject("2", "insufficient balance")
+	tree.ConsiderTransaction(tx, nil)
+
+	a := bt.NewNode(42, 1, []string{"1"}, signer, genesis)
+	tree.ConsiderLeaf(a)
+	tree.ConsiderLeaf(bt.NewNode(42, 2, []string{}, signer, a))
+	r.refresh(tree)
+
+	if rc, _ := r.get("1"); rc.Status != Included || rc.Slot != 1 || rc.Depth != 1 {
+		t.Error("Transaction not included", rc)
+	}
+	if rc, _ := r.get("2"); rc.Status != Rejected || rc.Reason != "insufficient balance" {
+		t.Error("Transaction not rejected", rc)
+	}
+
+	// a longer branch without the transaction
+	b := bt.NewNode(42, 3, []string{}, signer, genesis)
+	tree.ConsiderLeaf(b)
+	b = bt.NewNode(42, 4, []string{}, signer, b)
+	tree.ConsiderLeaf(b)
+	tree.ConsiderLeaf(bt.NewNode(42, 5, []string{}, signer, b))
+	r.refresh(tree)
+
+	if rc, _ := r.get("1"); rc.Status != Reverted || rc.Slot != 1 {
+		t.Error("Transaction not reverted", rc)
+	}
+	r.reject("1", "too late")
+	if rc, _ := r.get("1"); rc.Status != Reverted {
+		t.Error("Reverted transaction rejected", rc)
+	}
+
+	if list := r.list(); len(list) != 2 || list[0].Transaction.ID != "1" {
+		t.Error("Wrong list", list)
+	}
+}
+
+func TestReceiptsArePruned(t *testing.T) {
+	r := newReceipts()
+	for i := 0; i < 10; i++ {
+		r.track(NewTransaction(fmt.Sprint("rejected-", i), "a", "b", 1))
+		r.reject(fmt.Sprint("rejected-", i), "insufficient balance")
+	}
+	for i := 0; i < receiptsKept; i++ {
+		r.track(NewTransaction(fmt.Sprint(i), "a", "b", 1))
+	}
+
+	if len(r.list()) != receiptsKept || len(r.active) != receiptsKept {
+		t.Fatal("Receipts not capped", len(r.list()), len(r.active))
+	}
+	if _, found := r.get("rejected-0"); found {
+		t.Error("Final receipt kept instead of a pending one")
+	}
+
+	r.track(NewTransaction("last", "a", "b", 1))
+	if _, found := r.get("0"); found || len(r.list()) != receiptsKept {
+		t.Error("Oldest pending receipt kept over the cap")
+	}
+}
+
+func TestSubmittedTransactionsGetReceipts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Runs the protocol in real time")
+	}
+
+	c := newCluster(t, 3, 7, nil, nil)
+	defer c.stop()
+	nd := c.nodes[0]
+
+	paid := SignTransaction(NewTransaction("paid", c.account(0), c.account(1), 10), c.signers[0])
+	tooMuch := SignTransaction(NewTransaction("too-much", c.account(0), c.account(1), 1e7), c.signers[0])
+	forged := SignTransaction(NewTransaction("forged", c.account(0), c.account(1), 10), c.signers[1])
+	for _, st := range []SignedTransaction{paid, tooMuch, forged} {
+		nd.Track(st)
+		nd.Submit(st)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for rc, _ := nd.Receipt("paid"); rc.Status != Included; rc, _ = nd.Receipt("paid") {
+		if time.Now().After(deadline) {
+			t.Fatal("Transaction not included", rc)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if rc, _ := nd.Receipt("too-much"); rc.Status != Rejected {
+		t.Error("Transaction above the balance not rejected", rc)
+	}
+	if rc, _ := nd.Receipt("forged"); rc.Status != Rejected {
+		t.Error("Forged transaction not rejected", rc)
+	}
+}
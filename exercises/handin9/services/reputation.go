@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	. "../peers"
+)
+
+// Penalties lowering the score of a misbehaving peer
+const (
+	penaltyMalformed   = 100 // undecodable or tampered data
+	penaltyInvalidNode = 50  // bad signature or draw
+	penaltyInvalidTx   = 20  // bad signature
+	penaltySpam        = 5   // oversized or unexpected messages
+)
+
+// banThreshold is the score at which a peer is banned for banDuration
+const banThreshold = -100
+
+const banDuration = time.Hour
+
+// InitBans loads the ban list from file, where new bans are saved
+func (nd *Node) InitBans(file string) {
+	nd.Bans = NewBanList(file)
+}
+
+// penalize lowers the score of the peer, banning and disconnecting it under banThreshold
+func (nd *Node) penalize(p *Peer, points int, reason string) {
+	nd.stats.penalties.Inc()
+	score := p.Penalize(points)
+	nd.Log.Warn("Peer misbehaved", peerAttr(p), "reason", reason, "score", score)
+
+	if score <= banThreshold {
+		nd.Log.Warn("Banning peer", peerAttr(p), "duration", banDuration)
+		nd.ban(p)
+		p.Close() // handleConn notices and cleans up
+	}
+}
+
+// ban bans the proven key of the peer and the IP it connects from, not its advertised address
+// which it could change. The IPs of the local machine are spared, they are shared by its peers
+func (nd *Node) ban(p *Peer) {
+	if p.PubKey != "" {
+		nd.Bans.Ban(p.PubKey, banDuration)
+	}
+	if ip := net.ParseIP(p.RemoteIP()); ip != nil && !ip.IsLoopback() {
+		nd.Bans.Ban(ip.String(), banDuration)
+	}
+}
+
+// isBanned returns true if the IP or the key is banned, either can be empty
+func (nd *Node) isBanned(ip, key string) bool {
+	return (ip != "" && nd.Bans.IsBanned(ip)) || (key != "" && nd.Bans.IsBanned(key))
+}
+
+// remoteIP returns the IP of the remote end of conn
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// isMalformed returns true if a decoding error is not caused by the connection closing
+func isMalformed(err error) bool {
+	var netErr net.Error
+	return err != io.EOF && err != io.ErrUnexpectedEOF && !errors.As(err, &netErr)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"time"
+
+	. "../peers"
+)
+
+// sendQueueSize is the number of messages waiting for a peer before new ones are dropped
+const sendQueueSize = 256
+
+// writeTimeout is the time a peer has to accept a message before it is disconnected
+const writeTimeout = 10 * time.Second
+
+// maxDrops is the number of messages dropped in a row before a slow peer is disconnected
+const maxDrops = 64
+
+// send queues the message for the peer, disconnecting it if it can't keep up
+func (nd *Node) send(p *Peer, env Envelope) {
+	if p.Send(env) {
+		nd.stats.sent.With(env.Type.String()).Inc()
+		return
+	}
+	if !p.Connected() {
+		return
+	}
+	nd.stats.dropped.Inc()
+
+	if p.Drops() >= maxDrops {
+		nd.Log.Warn("Disconnecting a slow peer", peerAttr(p), "drops", p.Drops())
+		p.Close() // handleConn notices and cleans up
+	}
+}
+
+// sendAll queues the message for every connected peer
+func (nd *Node) sendAll(env Envelope) {
+	for p := range nd.PeerList.Iter() {
+		if p.Connected() {
+			nd.send(p, env)
+		}
+	}
+}
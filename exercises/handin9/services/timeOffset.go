@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The slots are derived from the clock, a peer whose clock is off loses its nodes, so the local one is
+// corrected by the median of the offsets of the clocks of the connected peers, measured on the handshakes.
+// A sample is kept by proven key while its peer is connected, so a peer can't vote twice.
+
+// minTimeSamples is the number of peers needed before the local clock is corrected
+const minTimeSamples = 3
+
+// maxTimeSamples is the number of peers whose offset is remembered
+const maxTimeSamples = 200
+
+// maxTimeOffset is the largest correction as a fraction of the slot, a larger one means the local clock
+// is badly wrong (or the peers lie, and the local nodes would be rejected as too early or too late)
+const maxTimeOffset = 0.25
+
+// timeOffsets keeps the offsets of the clocks of the connected peers by key
+type timeOffsets struct {
+	samples map[string]time.Duration
+	lock    sync.Mutex
+}
+
+func newTimeOffsets() *timeOffsets {
+	return &timeOffsets{samples: make(map[string]time.Duration)}
+}
+
+// add records the offset of the peer, returns the median (ours counting as zero) and the number of peers
+func (o *timeOffsets) add(key string, offset time.Duration) (time.Duration, int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if _, found := o.samples[key]; !found && len(o.samples) >= maxTimeSamples {
+		for k := range o.samples {
+			delete(o.samples, k)
+			break
+		}
+	}
+	o.samples[key] = offset
+
+	all := []time.Duration{0}
+	for _, s := range o.samples {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	median := all[len(all)/2]
+	if len(all)%2 == 0 {
+		median = (all[len(all)/2-1] + median) / 2
+	}
+	return median, len(o.samples)
+}
+
+// remove forgets the offset of a peer disconnected
+func (o *timeOffsets) remove(key string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.samples, key)
+}
+
+// noteClock records the offset of the clock of a peer once connected, from its handshake,
+// and corrects the local clock
+func (nd *Node) noteClock(hs *Handshake) {
+	if hs.Time == 0 {
+		return
+	}
+
+	median, peers := nd.offsets.add(hs.PubKey, time.Unix(0, hs.Time).Sub(hs.received))
+	if peers < minTimeSamples {
+		return
+	}
+
+	if limit := time.Duration(maxTimeOffset * float64(nd.Tree.SlotLength)); median > limit || median < -limit {
+		nd.Log.Warn("The local clock differs from the peers', please check it", "offset", median)
+		return
+	}
+	nd.Tree.SetTimeOffset(median)
+}
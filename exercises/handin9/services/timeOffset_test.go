@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "../account"
+	bt "../blocktree"
+	"../transport"
+)
+
+func TestTimeOffsetsMedian(t *testing.T) {
+	o := newTimeOffsets()
+
+	if median, n := o.add("key of a", time.Second); median != time.Second/2 || n != 1 {
+		t.Error("Wrong median of one peer and ours:", median, n)
+	}
+	o.add("key of b", 2*time.Second)
+	if median, n := o.add("key of c", -time.Hour); median != time.Second/2 || n != 3 {
+		t.Error("An outlier moved the median:", median, n)
+	}
+
+	// a peer reconnecting replaces its sample
+	if median, n := o.add("key of c", 3*time.Second); median != 3*time.Second/2 || n != 3 {
+		t.Error("Wrong median after an update:", median, n)
+	}
+}
+
+func TestClockCorrectedByDistinctKeysWithinTheSlot(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	a := newTestNode(t, transport.NewMem(1), "10.0.0.1", genesis)
+	clock := bt.NewSimClock(time.Unix(1000, 0))
+	a.Tree.Clock = clock
+
+	offset := func() time.Duration {
+		return a.Tree.Now().Sub(clock.Now())
+	}
+	sample := func(key string, d time.Duration) *Handshake {
+		return &Handshake{PubKey: key, Time: clock.Now().Add(d).UnixNano(), received: clock.Now()}
+	}
+
+	// one key declaring several addresses is a single sample
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		hs := sample("key of b", 100*time.Millisecond)
+		hs.IP = ip
+		a.noteClock(hs)
+	}
+	if offset() != 0 {
+		t.Error("Clock corrected by a single key", offset())
+	}
+
+	// the peers agreeing on a clock too far from ours are not followed
+	for _, key := range []string{"key of b", "key of c", "key of d"} {
+		a.noteClock(sample(key, a.Tree.SlotLength))
+	}
+	if offset() != 0 {
+		t.Error("Clock corrected by more than a fraction of the slot", offset())
+	}
+
+	for _, key := range []string{"key of b", "key of c", "key of d"} {
+		a.noteClock(sample(key, 100*time.Millisecond))
+	}
+	if offset() != 100*time.Millisecond {
+		t.Error("Clock not corrected", offset())
+	}
+}
@@ -2,36 +2,42 @@ package services
 
 import (
 	"fmt"
-	"sync"
 
 	. "../account"
 )
 
-// Wg is the waitgroup for all the services
-var Wg sync.WaitGroup
-
-var past = NewPastMap()
-
 // ProcessTransactions handles the trasaction recieved
-func ProcessTransactions(listenCh <-chan SignedTransaction, sequencerCh chan<- Transaction, quitCh <-chan struct{}) {
-	defer Wg.Done()
+func (nd *Node) ProcessTransactions() {
+	defer nd.Wg.Done()
 
 	for {
 		select {
-		case st := <-listenCh:
-			if t := st.ExtractTransaction(); !isOld(t) && isVerified(st) {
-				past.AddPast(t, true)
-				sequencerCh <- t
-				go broadcast(st)
+		case st := <-nd.listenCh:
+			t := st.ExtractTransaction()
+			switch {
+			case nd.isOld(t):
+			case !isVerified(st):
+				nd.receipts.reject(t.ID, "invalid signature or amount")
+			default:
+				if st.Multisig != nil {
+					nd.multisigs.propose(t.ID, *st.Multisig)
+				}
+				nd.past.AddPast(t, true)
+				select {
+				case nd.sequencerCh <- t:
+				case <-nd.quitCh:
+					return //Done
+				}
+				nd.broadcast(st)
 			}
-		case <-quitCh:
+		case <-nd.quitCh:
 			return //Done
 		}
 	}
 }
 
-func isOld(t Transaction) bool {
-	if val, found := past.GetPast(t); found && val {
+func (nd *Node) isOld(t Transaction) bool {
+	if val, found := nd.past.GetPast(t); found && val {
 		return true
 	}
 	return false
@@ -41,18 +47,12 @@ func isVerified(st SignedTransaction) bool {
 	return st.VerifyTransaction() && st.Amount > 0
 }
 
-func attachNextID(t Transaction) Transaction {
-	t.ID = fmt.Sprintf("%d-%s", past.GetPastLength(), LocalPeer.GetAddress())
-	past.AddPast(t, false)
+func (nd *Node) attachNextID(t Transaction) Transaction {
+	t.ID = fmt.Sprintf("%d-%s", nd.past.GetPastLength(), nd.LocalPeer().GetAddress())
+	nd.past.AddPast(t, false)
 	return t
 }
 
-func broadcast(st SignedTransaction) {
-	Wg.Add(1)
-	defer Wg.Done()
-
-	var w WhatType = st
-	for enc := range PeerList.IterEnc() {
-		enc.Encode(&w)
-	}
+func (nd *Node) broadcast(st SignedTransaction) {
+	nd.announce(txItem(&st), Envelope{Type: TransactionMsg, Transaction: &st})
 }
@@ -1,53 +1,127 @@
 package services
 
 import (
-	"fmt"
 	"time"
 
-	. "../account"
-	"../aesrsa"
 	bt "../blocktree"
-	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-// Tree is the blockchain tree
-var Tree *bt.Tree
+// lateTolerance is how long after its end a slot still collects nodes, for the peers with slow clocks or links
+const lateTolerance = 300 * time.Millisecond
+
+// earlyTolerance is how long before its start the nodes of the next slot are buffered instead of dropped,
+// for the peers with fast clocks
+const earlyTolerance = 300 * time.Millisecond
 
 // ProcessNodes implements the tree protocol
-func ProcessNodes(sequencerCh <-chan Transaction, blockCh <-chan bt.SignedNode, keys *aesrsa.RSAKeyPair, quitCh <-chan struct{}) {
-	defer Wg.Done()
+func (nd *Node) ProcessNodes() {
+	defer nd.Wg.Done()
 
 	oldSeq := make([]string, 0)
 	seq := make([]string, 0)
 
 	var winner *bt.Node
 	nodeOfSlot := bt.NodeSet{}
+	parked := &parking{}
+	early := []bt.SignedNode{} // of the next slot
+	equivocations := newEquivocations()
+	var produced uint64 // the slot of the last own node
+
+	// considerNode handles a verified node: the ones of the current slot compete to be the winner,
+	// the older ones (arrived late or fetched to catch up) are added to the tree directly,
+	// both only if their creator won the lottery of the slot
+	var considerNode func(sn bt.SignedNode)
+	considerNode = func(sn bt.SignedNode) {
+		n := &sn.Node
+		if ev, found := equivocations.check(sn); found {
+			nd.stats.equivocations.Inc()
+			nd.Log.Warn("Peer signed two nodes for the same slot", "account", ev.Offender(), "slot", ev.Slot())
+			nd.broadcastEvidence(ev)
+		}
+
+		switch {
+		case nd.Tree.HasNode(n) || alreadySeenInSlot(n, nodeOfSlot):
+		case n.Slot > nd.collectingSlot():
+			if nd.isEarly(n) && len(early) < maxParked {
+				early = append(early, sn)
+			}
+		case !isComplete(nd.Tree, n):
+			parked.park(sn)
+			if parent, found := nd.knownParent(n); found {
+				considerNode(parent)
+			}
+			nd.requestMissing(n)
+		case !nd.Tree.CheckEvidence(n):
+			// the offences were already punished
+		case !nd.Tree.CheckSeed(n) || !nd.Tree.Partecipating(n):
+			// its creator didn't win the lottery of the slot, like own nodes are checked
+		case nd.isNewSlot(n):
+			nodeOfSlot[bt.HashNode(n)] = struct{}{}
+			if winner == nil || nd.Tree.CompareValueOfNodes(n, winner) {
+				winner = n
+			}
+			nd.broadcastNode(sn)
+		case n.Slot < nd.collectingSlot():
+			if nd.Tree.ConsiderLeaf(n) {
+				nd.inv.keep(n)
+				nd.broadcastNode(sn)
+			}
+		}
+	}
+
+	// unpark considers the parked nodes until none becomes ready
+	unpark := func() {
+		for ready := parked.ready(nd.Tree); len(ready) > 0; ready = parked.ready(nd.Tree) {
+			for _, sn := range ready {
+				considerNode(sn)
+			}
+		}
+	}
 
 	timer := make(chan struct{})
-	go pollSlotNumber(timer, quitCh)
+	nd.Wg.Add(1)
+	go nd.notifySlots(timer)
 
 	for {
 		select {
 		case <-timer:
 			nodeOfSlot = bt.NodeSet{}
+			equivocations.prune(nd.collectingSlot())
 
 			// use winner for currentSlot-1
 			if winner != nil {
-				Tree.ConsiderLeaf(winner)
-				fmt.Println(Tree.GetLedger())
+				if nd.Tree.ConsiderLeaf(winner) {
+					nd.inv.keep(winner)
+					if winner.Peer == nd.LocalPeer().PubKey {
+						nd.stats.slotsWon.Inc()
+					}
+					nd.Log.Info("Applied the winner of the slot", append(nodeAttrs(winner), "transactions", len(winner.TransList))...)
+					nd.Log.Debug("Ledger of the head", "ledger", nd.Tree.GetLedger())
+				}
 				winner = nil
+				unpark()
+				nd.receipts.refresh(nd.Tree)
+				nd.multisigs.register(nd.Tree)
 			} else { // if no winner but there were transaction then save them
 				if len(oldSeq[:]) > 0 {
 					seq = append(oldSeq, seq...)
 				}
 			}
 
-			// make own node for current slot (just ended)
-			if len(seq[:]) > 0 {
-				n := bt.NewNode(Tree.GetSeed(), Tree.GetCurrentSlot(), seq, keys, Tree.GetHead())
-				if Tree.Partecipating(n) {
-					sn := bt.NewSignedNode(*n, keys.Private)
-					go broadcastNode(*sn)
+			// make own node for current slot (just ended), punishing the equivocations,
+			// once per slot: a second one would be an equivocation
+			slot := nd.ownSlot()
+			if evidence := equivocations.pending(nd.Tree); (len(seq[:]) > 0 || len(evidence) > 0) && slot > produced {
+				n := bt.NewNode(nd.Tree.GetSeed(), slot, seq, nd.signer, nd.Tree.GetHead())
+				n.Evidence = evidence
+				if nd.Tree.Partecipating(n) {
+					produced = n.Slot
+					sn := bt.NewSignedNode(*n, nd.signer)
+					nd.stats.nodesCreated.Inc()
+					nd.broadcastNode(*sn)
+					if nd.Adversary == Equivocate {
+						nd.equivocate(n)
+					}
 					winner = n
 					nodeOfSlot[bt.HashNode(n)] = struct{}{}
 				}
@@ -55,26 +129,48 @@ func ProcessNodes(sequencerCh <-chan Transaction, blockCh <-chan bt.SignedNode,
 			oldSeq = seq
 			seq = make([]string, 0)
 
-		case t := <-sequencerCh:
-			if Tree.ConsiderTransaction(t, seq) {
+			// the nodes arrived early compete now
+			for _, sn := range early {
+				considerNode(sn)
+			}
+			early = []bt.SignedNode{}
+			unpark()
+
+		case t := <-nd.sequencerCh:
+			if nd.Tree.ConsiderTransaction(t, seq) {
 				seq = append(seq, t.ID)
+			} else {
+				nd.receipts.reject(t.ID, "insufficient balance")
 			}
-		case sn := <-blockCh:
-			if n := &sn.Node; isNewSlot(n) && !alreadySeenInSlot(n, nodeOfSlot) && Tree.CheckIsNext(n) && sn.VerifyNode() {
-				nodeOfSlot[bt.HashNode(n)] = struct{}{}
-				if winner == nil || Tree.CompareValueOfNodes(n, winner) {
-					winner = n
-				}
-				go broadcastNode(sn)
+			unpark()
+		case sn := <-nd.blockCh:
+			if nd.verifyNode(sn) {
+				considerNode(sn)
+				unpark()
 			}
-		case <-quitCh:
+		case ev := <-nd.evidenceCh:
+			if equivocations.add(ev) {
+				nd.stats.equivocations.Inc()
+				nd.broadcastEvidence(ev)
+			}
+		case <-nd.quitCh:
 			return //Done
 		}
 	}
 }
 
-func isNewSlot(n *bt.Node) bool {
-	return Tree.BelongsToCurrentSlot(n)
+func (nd *Node) isNewSlot(n *bt.Node) bool {
+	return n.Slot == nd.collectingSlot()
+}
+
+// isEarly returns true if the node is of the next slot, which starts within earlyTolerance
+func (nd *Node) isEarly(n *bt.Node) bool {
+	return n.Slot == nd.collectingSlot()+1 && nd.Tree.Now().After(nd.Tree.SlotStart(n.Slot).Add(-earlyTolerance))
+}
+
+// collectingSlot is the slot whose nodes compete, it ends lateTolerance after the clock's one
+func (nd *Node) collectingSlot() uint64 {
+	return nd.Tree.SlotAt(nd.Tree.Now().Add(-lateTolerance))
 }
 
 func alreadySeenInSlot(n *bt.Node, nodeOfSlot bt.NodeSet) bool {
@@ -82,32 +178,33 @@ func alreadySeenInSlot(n *bt.Node, nodeOfSlot bt.NodeSet) bool {
 	return found
 }
 
-func broadcastNode(sn bt.SignedNode) {
-	Wg.Add(1)
-	defer Wg.Done()
-
-	var w WhatType = sn
-	for enc := range PeerList.IterEnc() {
-		enc.Encode(&w)
-	}
+func (nd *Node) broadcastNode(sn bt.SignedNode) {
+	nd.announce(nodeItem(&sn), Envelope{Type: NodeMsg, Node: &sn})
 }
 
-func pollSlotNumber(timer chan<- struct{}, quitCh <-chan struct{}) {
-	Wg.Add(1)
-	defer Wg.Done()
+// notifySlots signals on timer the end of each collecting slot, once even if the clock is corrected backwards
+func (nd *Node) notifySlots(timer chan<- struct{}) {
+	defer nd.Wg.Done()
 
-	oldSlot := Tree.GetCurrentSlot()
+	last := nd.collectingSlot() // the slots up to it are never signalled (again)
 	for {
 		select {
-		case <-quitCh:
-			return
-		default:
-			wait.PollInfinite(time.Millisecond*100, wait.ConditionFunc(func() (bool, error) {
-				return Tree.GetCurrentSlot() > oldSlot, nil
-			}))
-			oldSlot = Tree.GetCurrentSlot()
-
-			timer <- struct{}{}
+		case <-nd.Tree.AfterSlot(last+1, lateTolerance):
+		case <-nd.quitCh:
+			return //Done
+		}
+
+		// the clock may have been corrected backwards meanwhile
+		current := nd.collectingSlot()
+		if current <= last {
+			continue
+		}
+
+		select {
+		case timer <- struct{}{}:
+			last = current
+		case <-nd.quitCh:
+			return //Done
 		}
 	}
 }
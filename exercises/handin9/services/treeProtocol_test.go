@@ -0,0 +1,120 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "../account"
+	"../aesrsa"
+	bt "../blocktree"
+	"../transport"
+)
+
+// newTestSigner generates a key for the nodes signed by the tests
+func newTestSigner(t *testing.T) aesrsa.Signer {
+	signer, err := aesrsa.GenerateSigner(aesrsa.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// winningNode returns a node of the signer child of parent, for the first slot from the given one it wins
+func winningNode(tree *bt.Tree, signer aesrsa.Signer, seed, slot uint64, parent *bt.Node) *bt.Node {
+	for ; ; slot++ {
+		if n := bt.NewNode(seed, slot, []string{}, signer, parent); tree.Partecipating(n) {
+			return n
+		}
+	}
+}
+
+func TestPastNodesNeedTheLottery(t *testing.T) {
+	founder := newTestSigner(t)
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", AddressFromKey(aesrsa.VerifierToString(founder.Verifier())), 1e6)}
+	tree := bt.NewTree(genesis)
+	tree.Clock = bt.NewSimClock(time.Unix(1000, 0))
+
+	nd := NewNode(tree, founder, transport.NewMem(1).Host("10.0.0.1"))
+	nd.Wg.Add(1)
+	go nd.ProcessNodes()
+	defer nd.Stop()
+
+	// a key without stake builds a longer chain of past slots
+	forger := newTestSigner(t)
+	forged := []*bt.Node{}
+	parent := tree.GetHead()
+	for slot := uint64(1); slot <= 3; slot++ {
+		n := bt.NewNode(parent.Seed, slot, []string{}, forger, parent)
+		nd.blockCh <- *bt.NewSignedNode(*n, forger)
+		forged = append(forged, n)
+		parent = n
+	}
+
+	// a founder's node with another seed than its parent
+	reseeded := winningNode(tree, founder, 43, 10, tree.GetHead())
+	nd.blockCh <- *bt.NewSignedNode(*reseeded, founder)
+
+	honest := winningNode(tree, founder, tree.GetHead().Seed, 20, tree.GetHead())
+	nd.blockCh <- *bt.NewSignedNode(*honest, founder)
+
+	// the head is read under the lock of the tree, unlike HasNode
+	deadline := time.Now().Add(5 * time.Second)
+	for bt.HashNode(tree.GetHead()) != bt.HashNode(honest) {
+		if time.Now().After(deadline) {
+			t.Fatal("Node of the founder not added")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, n := range forged {
+		if tree.HasNode(n) {
+			t.Error("Node of a key without stake added, slot", n.Slot)
+		}
+	}
+	if tree.HasNode(reseeded) {
+		t.Error("Node with another seed than its parent added")
+	}
+}
+
+func TestSlotsSignalledOnceWhenTheClockGoesBack(t *testing.T) {
+	genesis := []Transaction{NewTransaction("Genesis - 0", "Genesis", "founder", 1e6)}
+	tree := bt.NewTree(genesis)
+	clock := bt.NewSimClock(time.Unix(1000, 0))
+	tree.Clock = clock
+
+	nd := NewNode(tree, newTestSigner(t), transport.NewMem(1).Host("10.0.0.1"))
+	timer := make(chan struct{})
+	nd.Wg.Add(1)
+	go nd.notifySlots(timer)
+	defer nd.Stop()
+
+	signalled := func() bool {
+		select {
+		case <-timer:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond) // the loop waits for the end of the slot
+	clock.Advance(tree.SlotLength)
+	if !signalled() {
+		t.Fatal("End of the slot not signalled")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// corrected back before the slot just signalled, which then ends again
+	tree.SetTimeOffset(-tree.SlotLength * 3 / 2)
+	clock.Advance(tree.SlotLength / 2)
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(tree.SlotLength / 2)
+	if signalled() {
+		t.Error("Slot signalled twice")
+	}
+
+	clock.Advance(tree.SlotLength)
+	if !signalled() {
+		t.Error("Next slot not signalled")
+	}
+}
@@ -0,0 +1,401 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mem is an in-process network: every host has a Transport (see Host) and the connections
+// between them are buffered pipes with configurable latency, loss and partitions.
+// A lost write is delivered again after retransmitDelay as TCP would, so the streams stay intact.
+type Mem struct {
+	listeners map[string]*memListener
+	groups    map[string]int // partition of each host, hosts not listed are in group 0
+	conns     []*memConn
+
+	latency, jitter time.Duration
+	loss            float64
+	nextPort        int
+	random          *rand.Rand
+
+	lock sync.Mutex
+}
+
+// retransmitDelay is the delay added to a lost write
+const retransmitDelay = 200 * time.Millisecond
+
+// ErrUnreachable is returned dialing a host in another partition
+var ErrUnreachable = errors.New("network is unreachable")
+
+// NewMem is the constructor of the Mem type, the seed makes latency and loss reproducible
+func NewMem(seed int64) *Mem {
+	return &Mem{
+		listeners: make(map[string]*memListener),
+		groups:    make(map[string]int),
+		nextPort:  40000,
+		random:    rand.New(rand.NewSource(seed))}
+}
+
+// SetLatency sets the delay of every write to latency plus a random value up to jitter
+func (m *Mem) SetLatency(latency, jitter time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.latency, m.jitter = latency, jitter
+}
+
+// SetLoss sets the probability that a write is lost (and retransmitted)
+func (m *Mem) SetLoss(p float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.loss = p
+}
+
+// Partition splits the hosts in groups that can't reach each other, the connections
+// between different groups are reset. Hosts not listed form a group of their own.
+func (m *Mem) Partition(groups ...[]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.groups = make(map[string]int)
+	for i, g := range groups {
+		for _, host := range g {
+			m.groups[host] = i + 1
+		}
+	}
+
+	for _, c := range m.conns {
+		if m.groups[c.local.host] != m.groups[c.remote.host] {
+			c.Close()
+		}
+	}
+}
+
+// Heal removes the partitions
+func (m *Mem) Heal() {
+	m.Partition()
+}
+
+// Host returns the transport used by host (an IP), the address of its connections
+func (m *Mem) Host(host string) Transport {
+	return &memHost{m, host}
+}
+
+// delay returns when a write done now should be delivered
+func (m *Mem) delay() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	d := m.latency
+	if m.jitter > 0 {
+		d += time.Duration(m.random.Int63n(int64(m.jitter)))
+	}
+	for m.loss > 0 && m.random.Float64() < m.loss {
+		d += retransmitDelay
+	}
+	return d
+}
+
+func (m *Mem) port() int {
+	m.nextPort++
+	return m.nextPort
+}
+
+/////////// Transport of a host ///////////
+
+type memHost struct {
+	mem  *Mem
+	host string
+}
+
+func (h *memHost) Dial(address string) (net.Conn, error) {
+	m := h.mem
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.groups[host] != m.groups[h.host] {
+		return nil, &net.OpError{Op: "dial", Net: "mem", Err: ErrUnreachable}
+	}
+
+	ln, found := m.listeners[address]
+	if !found {
+		return nil, &net.OpError{Op: "dial", Net: "mem", Err: errors.New("connection refused")}
+	}
+
+	local := memAddr{h.host, m.port()}
+	client, server := newMemConnPair(m, local, ln.addr)
+
+	select {
+	case ln.accept <- server:
+	default: // backlog full or closed
+		return nil, &net.OpError{Op: "dial", Net: "mem", Err: errors.New("connection refused")}
+	}
+
+	kept := m.conns[:0]
+	for _, c := range m.conns {
+		if !c.isClosed() {
+			kept = append(kept, c)
+		}
+	}
+	m.conns = append(kept, client, server)
+	return client, nil
+}
+
+func (h *memHost) Listen(address string) (net.Listener, error) {
+	m := h.mem
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" && host != h.host {
+		return nil, errors.New("cannot listen on " + host + " from " + h.host)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	if p == 0 {
+		p = m.port()
+	}
+
+	addr := memAddr{h.host, p}
+	if _, found := m.listeners[addr.String()]; found {
+		return nil, errors.New("address already in use")
+	}
+
+	ln := &memListener{
+		mem:    m,
+		addr:   addr,
+		accept: make(chan net.Conn, 16),
+		closed: make(chan struct{})}
+	m.listeners[addr.String()] = ln
+	return ln, nil
+}
+
+/////////// Listener ///////////
+
+type memAddr struct {
+	host string
+	port int
+}
+
+func (a memAddr) Network() string { return "mem" }
+
+func (a memAddr) String() string { return net.JoinHostPort(a.host, strconv.Itoa(a.port)) }
+
+type memListener struct {
+	mem    *Mem
+	addr   memAddr
+	accept chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (ln *memListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ln.accept:
+		return c, nil
+	case <-ln.closed:
+		return nil, &net.OpError{Op: "accept", Net: "mem", Err: net.ErrClosed}
+	}
+}
+
+func (ln *memListener) Close() error {
+	ln.once.Do(func() {
+		close(ln.closed)
+
+		ln.mem.lock.Lock()
+		delete(ln.mem.listeners, ln.addr.String())
+		ln.mem.lock.Unlock()
+	})
+	return nil
+}
+
+func (ln *memListener) Addr() net.Addr { return ln.addr }
+
+/////////// Connection ///////////
+
+// chunk is a write waiting to be delivered
+type chunk struct {
+	data []byte
+	at   time.Time
+}
+
+// pipe is one direction of a connection, writes never block
+type pipe struct {
+	chunks []chunk
+	last   time.Time // delivery time of the last chunk, to keep the order
+	closed bool
+	notify chan struct{}
+	lock   sync.Mutex
+}
+
+func newPipe() *pipe {
+	return &pipe{notify: make(chan struct{}, 1)}
+}
+
+func (p *pipe) wake() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipe) close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	p.wake()
+}
+
+type memConn struct {
+	mem           *Mem
+	local, remote memAddr
+	in, out       *pipe
+	closed        int32
+
+	readDeadline, writeDeadline time.Time
+	deadlineLock                sync.Mutex
+}
+
+func newMemConnPair(m *Mem, a, b memAddr) (*memConn, *memConn) {
+	ab, ba := newPipe(), newPipe()
+	return &memConn{mem: m, local: a, remote: b, in: ba, out: ab},
+		&memConn{mem: m, local: b, remote: a, in: ab, out: ba}
+}
+
+func (c *memConn) Read(b []byte) (int, error) {
+	for {
+		if c.isClosed() {
+			return 0, &net.OpError{Op: "read", Net: "mem", Err: net.ErrClosed}
+		}
+
+		c.in.lock.Lock()
+		now := time.Now()
+
+		if len(c.in.chunks) > 0 && !c.in.chunks[0].at.After(now) {
+			first := &c.in.chunks[0]
+			n := copy(b, first.data)
+			first.data = first.data[n:]
+			if len(first.data) == 0 {
+				c.in.chunks = c.in.chunks[1:]
+			}
+			c.in.lock.Unlock()
+			return n, nil
+		}
+
+		if c.in.closed && len(c.in.chunks) == 0 {
+			c.in.lock.Unlock()
+			return 0, io.EOF
+		}
+
+		wait := time.Hour
+		if len(c.in.chunks) > 0 {
+			wait = c.in.chunks[0].at.Sub(now)
+		}
+		c.in.lock.Unlock()
+
+		c.deadlineLock.Lock()
+		deadline := c.readDeadline
+		c.deadlineLock.Unlock()
+
+		if !deadline.IsZero() {
+			if !deadline.After(now) {
+				return 0, os.ErrDeadlineExceeded
+			}
+			if d := deadline.Sub(now); d < wait {
+				wait = d
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.in.notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (c *memConn) Write(b []byte) (int, error) {
+	c.deadlineLock.Lock()
+	deadline := c.writeDeadline
+	c.deadlineLock.Unlock()
+
+	if !deadline.IsZero() && !deadline.After(time.Now()) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	delay := c.mem.delay()
+
+	c.out.lock.Lock()
+	if c.out.closed {
+		c.out.lock.Unlock()
+		return 0, &net.OpError{Op: "write", Net: "mem", Err: net.ErrClosed}
+	}
+
+	at := time.Now().Add(delay)
+	if at.Before(c.out.last) {
+		at = c.out.last
+	}
+	c.out.last = at
+	c.out.chunks = append(c.out.chunks, chunk{append([]byte{}, b...), at})
+	c.out.lock.Unlock()
+
+	c.out.wake()
+	return len(b), nil
+}
+
+// Close closes both directions, the remote end reads what was already written and then EOF
+func (c *memConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	c.in.close()
+	c.out.close()
+	return nil
+}
+
+func (c *memConn) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func (c *memConn) LocalAddr() net.Addr { return c.local }
+
+func (c *memConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.readDeadline = t
+	c.deadlineLock.Unlock()
+
+	c.in.wake()
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	c.writeDeadline = t
+	c.deadlineLock.Unlock()
+	return nil
+}
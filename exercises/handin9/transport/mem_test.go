@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func dialPair(t *testing.T, m *Mem) (client, server net.Conn) {
+	ln, err := m.Host("10.0.0.1").Listen("10.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c, err := m.Host("10.0.0.2").Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestMemLatencyKeepsOrder(t *testing.T) {
+	m := NewMem(1)
+	m.SetLatency(20*time.Millisecond, 20*time.Millisecond)
+	m.SetLoss(0.3)
+
+	c, s := dialPair(t, m)
+	defer c.Close()
+
+	start := time.Now()
+	for i := byte(0); i < 50; i++ {
+		c.Write([]byte{i})
+	}
+
+	buf := make([]byte, 1)
+	for i := byte(0); i < 50; i++ {
+		if _, err := io.ReadFull(s, buf); err != nil || buf[0] != i {
+			t.Fatal("Expected", i, "got", buf[0], err)
+		}
+	}
+
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("Latency not applied")
+	}
+}
+
+func TestMemCloseGivesEOF(t *testing.T) {
+	m := NewMem(1)
+	m.SetLatency(20*time.Millisecond, 0)
+	c, s := dialPair(t, m)
+
+	c.Write([]byte("bye"))
+	c.Close()
+
+	data, err := io.ReadAll(s)
+	if err != nil || string(data) != "bye" {
+		t.Error("Unexpected read", string(data), err)
+	}
+}
+
+func TestMemPartition(t *testing.T) {
+	m := NewMem(1)
+	c, s := dialPair(t, m)
+
+	m.Partition([]string{"10.0.0.1"}, []string{"10.0.0.2"})
+
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Error("Connection across the partition still open")
+	}
+	if _, err := c.Write([]byte{0}); err == nil {
+		t.Error("Write across the partition succeeded")
+	}
+
+	ln, _ := m.Host("10.0.0.1").Listen(":0")
+	defer ln.Close()
+	if _, err := m.Host("10.0.0.2").Dial(ln.Addr().String()); err == nil {
+		t.Error("Dial across the partition succeeded")
+	}
+
+	m.Heal()
+	if _, err := m.Host("10.0.0.2").Dial(ln.Addr().String()); err != nil {
+		t.Error("Dial after healing failed:", err)
+	}
+}
+
+func TestMemReadDeadline(t *testing.T) {
+	c, s := dialPair(t, NewMem(1))
+	defer c.Close()
+
+	s.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Error("Read did not time out")
+	}
+}
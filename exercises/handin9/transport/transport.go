@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"net"
+	"time"
+)
+
+// Transport opens the connections between peers, so that the services don't depend on TCP
+type Transport interface {
+	// Dial connects to the listener at address (host:port)
+	Dial(address string) (net.Conn, error)
+	// Listen accepts connections on address (host:port), the port 0 picks a free one
+	Listen(address string) (net.Listener, error)
+}
+
+// dialTimeout is the time to wait for a TCP connection to be established
+const dialTimeout = 10 * time.Second
+
+// TCP is the transport over the real network
+type TCP struct{}
+
+// Dial opens a TCP connection
+func (TCP) Dial(address string) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, dialTimeout)
+}
+
+// Listen opens a TCP listening socket
+func (TCP) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package transport
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskLock serializes the changes of the umask, which is shared by the whole process
+var umaskLock sync.Mutex
+
+// ListenUnix listens on a unix socket only the owner can connect to, the socket is created
+// under a restrictive umask so that it is never open to others, not even before a chmod
+func ListenUnix(socket string) (net.Listener, error) {
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
+
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package transport
+
+import "net"
+
+// ListenUnix listens on a unix socket, the permissions of the file are not enforced on this system
+func ListenUnix(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
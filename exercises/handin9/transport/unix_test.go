@@ -0,0 +1,30 @@
+//go:build unix
+
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestUnixSocketOnlyForTheOwner(t *testing.T) {
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Error("Socket open to others", info.Mode())
+	}
+}